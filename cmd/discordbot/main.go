@@ -3,6 +3,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -12,6 +13,7 @@ import (
 	"github.com/osa030/19box-discordbot/internal/app/bot"
 	"github.com/osa030/19box-discordbot/internal/jukebox"
 	"github.com/osa030/19box-discordbot/internal/logger"
+	"github.com/osa030/19box-discordbot/internal/store"
 	"github.com/osa030/19box-discordbot/internal/timezone"
 	zlog "github.com/rs/zerolog/log"
 )
@@ -25,10 +27,26 @@ var (
 	server  = app.Flag("server", "Server address").Default(defaultServerURL).Envar("JUKEBOX_SERVER_URL").String()
 	verbose = app.Flag("verbose", "Enable verbose (DEBUG) logging").Short('v').Envar("VERBOSE").Bool()
 	logfile = app.Flag("logfile", "Path to log file (default: stdout)").Envar("LOGFILE").String()
+	config  = app.Flag("config", "Path to YAML config file (flags and env vars override its values)").Envar("CONFIG_FILE").String()
+
+	metricsAddr = app.Flag("metrics-addr", "Address to serve metrics on at /debug/vars (default: disabled)").Envar("METRICS_ADDR").String()
+
+	stateFile        = app.Flag("state-file", "Path to the JSON file persisting session state (default: in memory)").Envar("STATE_FILE").String()
+	reconnectTimeout = app.Flag("reconnect-timeout", "Give up reconnecting to the server after this long (0 disables reconnection)").Default("5m").Envar("JUKEBOX_RECONNECT_TIMEOUT").Duration()
 
 	token   = app.Flag("token", "Discord bot token").Envar("DISCORD_BOT_TOKEN").String()
 	guildID = app.Flag("guild-id", "Discord guild ID").Envar("DISCORD_GUILD_ID").String()
 	forumID = app.Flag("forum-id", "Discord forum ID").Envar("DISCORD_FORUM_ID").String()
+
+	adminRoleID = app.Flag("admin-role-id", "Discord role ID allowed to use /admin").Envar("DISCORD_ADMIN_ROLE_ID").String()
+	locale      = app.Flag("locale", "Default message locale (ja or en)").Envar("DISCORD_LOCALE").String()
+
+	liveNowPlaying  = newBoolFlag("live-nowplaying", "Keep a single pinned now playing message in the topic and edit it", "DISCORD_LIVE_NOWPLAYING")
+	scheduledEvents = newBoolFlag("scheduled-events", "Mirror each session as a Discord scheduled event", "DISCORD_SCHEDULED_EVENTS")
+	reminders       = app.Flag("reminder", "Post a reminder this long before a scheduled session starts (repeatable)").DurationList()
+
+	spotifyClientID     = app.Flag("spotify-client-id", "Spotify app client ID, used by /req-multi to list album and playlist tracks").Envar("SPOTIFY_CLIENT_ID").String()
+	spotifyClientSecret = app.Flag("spotify-client-secret", "Spotify app client secret").Envar("SPOTIFY_CLIENT_SECRET").String()
 )
 
 func init() {
@@ -50,27 +68,73 @@ func main() {
 		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
 	}
 
-	// Initialize config from flags/env vars
-	cfg := bot.DiscordBotConfig{
-		Token:   *token,
-		GuildID: *guildID,
-		ForumID: *forumID,
+	// Initialize config from the config file, then override it with flags/env vars
+	var cfg bot.DiscordBotConfig
+	if *config != "" {
+		loaded, err := bot.LoadConfig(*config)
+		if err != nil {
+			zlog.Error().Msgf("Failed to load config: %v", err)
+			os.Exit(1)
+		}
+		cfg = *loaded
+	}
+	override(&cfg.Token, *token)
+	override(&cfg.GuildID, *guildID)
+	override(&cfg.ForumID, *forumID)
+	override(&cfg.AdminRoleID, *adminRoleID)
+	override(&cfg.Locale, *locale)
+	liveNowPlaying.override(&cfg.LiveNowPlaying)
+	scheduledEvents.override(&cfg.ScheduledEvents)
+	if len(*reminders) > 0 {
+		cfg.Reminders = *reminders
 	}
+	override(&cfg.Spotify.ClientID, *spotifyClientID)
+	override(&cfg.Spotify.ClientSecret, *spotifyClientSecret)
 
 	// Validate config
 	if err := cfg.Validate(); err != nil {
 		zlog.Error().Msgf("Config validation failed: %v", err)
-		zlog.Info().Msg("Please provide required settings via flags or environment variables.")
+		zlog.Info().Msg("Please provide required settings via the config file, flags or environment variables.")
 		os.Exit(1)
 	}
 
 	zlog.Debug().Msgf("config.token:[%s]", cfg.Token)
 	zlog.Debug().Msgf("config.forum_id:[%s]", cfg.ForumID)
 	zlog.Debug().Msgf("config.guild_id:[%s]", cfg.GuildID)
+	zlog.Debug().Msgf("config.admin_role_id:[%s]", cfg.AdminRoleID)
+	zlog.Debug().Msgf("config.locale:[%s]", cfg.Locale)
+	zlog.Debug().Msgf("config.live_now_playing:[%v]", cfg.LiveNowPlaying)
+	zlog.Debug().Msgf("config.reminders:%v", cfg.Reminders)
+	zlog.Debug().Msgf("config.scheduled_events:[%v]", cfg.ScheduledEvents)
+	zlog.Debug().Msgf("config.multi_request_limit:[%d]", cfg.MultiRequestLimit)
+	zlog.Debug().Msgf("config.spotify.client_id:[%s]", cfg.Spotify.ClientID)
+	for _, guild := range cfg.Guilds {
+		zlog.Debug().Msgf("config.guilds:[%s] forum_id:[%s] admin_role_ids:%v locale:[%s]", guild.GuildID, guild.ForumID, guild.AdminRoleIDs, guild.Locale)
+	}
+
+	if *metricsAddr != "" {
+		// expvar publishes its variables on the default mux
+		go func() {
+			zlog.Info().Msgf("Serving metrics on %s", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, nil); err != nil {
+				zlog.Error().Msgf("Error serving metrics: %v", err)
+			}
+		}()
+	}
 
-	client := jukebox.NewClient(*server)
+	client := jukebox.NewClient(*server, *reconnectTimeout)
+
+	var st store.Store = store.NewMemoryStore()
+	if *stateFile != "" {
+		fileStore, err := store.NewFileStore(*stateFile)
+		if err != nil {
+			zlog.Error().Msgf("Failed to open state file: %v", err)
+			os.Exit(1)
+		}
+		st = fileStore
+	}
 
-	bot, err := bot.NewBot(&cfg, client)
+	bot, err := bot.NewBot(&cfg, client, st)
 	if err != nil {
 		zlog.Error().Msgf("Failed to init bot: %v", err)
 		os.Exit(1)
@@ -92,3 +156,32 @@ func main() {
 		zlog.Error().Msgf("Bot error: %v", err)
 	}
 }
+
+// override replaces *dst with value when value is set.
+func override(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
+
+// boolFlag is a bool flag that overrides the config file only when it is
+// given, on the command line (--name or --no-name) or in its environment
+// variable, so that it can turn a file value off as well as on.
+type boolFlag struct {
+	value *bool
+	set   bool
+	envar string
+}
+
+func newBoolFlag(name string, help string, envar string) *boolFlag {
+	f := &boolFlag{envar: envar}
+	f.value = app.Flag(name, help).Envar(envar).IsSetByUser(&f.set).Bool()
+	return f
+}
+
+// override replaces *dst with the flag value when the flag was given.
+func (f *boolFlag) override(dst *bool) {
+	if _, ok := os.LookupEnv(f.envar); f.set || ok {
+		*dst = *f.value
+	}
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	cmdAdminName          = "admin"
+	cmdAdminPauseName     = "pause"
+	cmdAdminResumeName    = "resume"
+	cmdAdminSkipName      = "skip"
+	cmdAdminStopName      = "stop"
+	cmdAdminKickName      = "kick"
+	cmdAdminListenersName = "listeners"
+	cmdAdminStatusName    = "status"
+	cmdOptionUserName     = "user"
+
+	// Discord rejects message content longer than this.
+	maxMessageLength = 2000
+)
+
+func adminCommand(locale string) *discordgo.ApplicationCommand {
+	subcommand := func(name, description string, options ...*discordgo.ApplicationCommandOption) *discordgo.ApplicationCommandOption {
+		return &discordgo.ApplicationCommandOption{
+			Type:                     discordgo.ApplicationCommandOptionSubCommand,
+			Name:                     name,
+			Description:              tr(locale, description),
+			DescriptionLocalizations: *localizations(description),
+			Options:                  options,
+		}
+	}
+	return &discordgo.ApplicationCommand{
+		Name:                     cmdAdminName,
+		Description:              tr(locale, cmdAdminDescription),
+		DescriptionLocalizations: localizations(cmdAdminDescription),
+		Options: []*discordgo.ApplicationCommandOption{
+			subcommand(cmdAdminPauseName, cmdAdminPauseDescription),
+			subcommand(cmdAdminResumeName, cmdAdminResumeDescription),
+			subcommand(cmdAdminSkipName, cmdAdminSkipDescription),
+			subcommand(cmdAdminStopName, cmdAdminStopDescription),
+			subcommand(cmdAdminKickName, cmdAdminKickDescription, &discordgo.ApplicationCommandOption{
+				Type:                     discordgo.ApplicationCommandOptionUser,
+				Name:                     cmdOptionUserName,
+				Description:              tr(locale, cmdOptionUserDesc),
+				DescriptionLocalizations: *localizations(cmdOptionUserDesc),
+				Required:                 true,
+			}),
+			subcommand(cmdAdminListenersName, cmdAdminListenersDescription),
+			subcommand(cmdAdminStatusName, cmdAdminStatusDescription),
+		},
+	}
+}
+
+func (b *Bot) handleAdmin(i *discordgo.InteractionCreate) {
+	locale := b.locale(i)
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		zlog.Error().Msg("No subcommand provided")
+		b.responseUpdate(i, tr(locale, msgInternalError))
+		return
+	}
+	subcommand := options[0]
+
+	if !b.isAdmin(i) {
+		audit(i, subcommand.Name, "forbidden")
+		b.responseUpdate(i, tr(locale, msgAdminForbidden))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var (
+		success bool
+		message string
+		err     error
+	)
+	switch subcommand.Name {
+	case cmdAdminPauseName:
+		success, message, err = b.client.Pause(ctx)
+	case cmdAdminResumeName:
+		success, message, err = b.client.Resume(ctx)
+	case cmdAdminSkipName:
+		success, message, err = b.client.Skip(ctx)
+	case cmdAdminStopName:
+		success, message, err = b.client.StopSession(ctx)
+	case cmdAdminKickName:
+		success, message, err = b.kickListener(ctx, locale, subcommand.Options)
+	case cmdAdminListenersName:
+		success = true
+		message, err = b.listListeners(ctx, locale)
+	case cmdAdminStatusName:
+		audit(i, subcommand.Name, "")
+		b.handleStatus(i)
+		return
+	default:
+		zlog.Warn().Msgf("Unknown admin subcommand: %s", subcommand.Name)
+		audit(i, subcommand.Name, "unknown")
+		b.responseUpdate(i, tr(locale, msgInternalError))
+		return
+	}
+	if err != nil {
+		zlog.Error().Msgf("Error admin %s: %v", subcommand.Name, err)
+		audit(i, subcommand.Name, "error: "+err.Error())
+		b.responseUpdate(i, tr(locale, msgInternalError))
+		return
+	}
+
+	audit(i, subcommand.Name, fmt.Sprintf("success=%v message=%s", success, message))
+	if message == "" {
+		message = tr(locale, msgAdminDone)
+	}
+	if !success {
+		message = tr(locale, msgAdminFailed, message)
+	}
+	b.responseUpdate(i, truncate(message, maxMessageLength))
+}
+
+// isAdmin reports whether the invoking member has one of the admin roles of
+// the guild the command was invoked in.
+func (b *Bot) isAdmin(i *discordgo.InteractionCreate) bool {
+	g := b.guild(i.GuildID)
+	if i.Member == nil || g == nil {
+		return false
+	}
+	return g.isAdmin(i.Member.Roles)
+}
+
+func (b *Bot) kickListener(ctx context.Context, locale string, options []*discordgo.ApplicationCommandInteractionDataOption) (bool, string, error) {
+	if len(options) == 0 {
+		return false, "", errors.New("no user provided")
+	}
+	user := options[0].UserValue(nil)
+	listenerID, ok := b.tokens.Load(user.ID)
+	if !ok {
+		return false, tr(locale, msgAdminListenerNotFound, user.ID), nil
+	}
+	return b.client.Kick(ctx, listenerID)
+}
+
+func (b *Bot) listListeners(ctx context.Context, locale string) (string, error) {
+	listeners, err := b.client.ListListeners(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(listeners) == 0 {
+		return tr(locale, msgAdminNoListeners), nil
+	}
+	var sb strings.Builder
+	for _, listener := range listeners {
+		var kicked string
+		if listener.IsKicked {
+			kicked = tr(locale, msgAdminListenerKicked)
+		}
+		sb.WriteString(tr(locale, msgAdminListenerLine, listener.DisplayName, listener.PendingTracks, kicked))
+	}
+	return sb.String(), nil
+}
+
+// audit records an admin command invocation in the log.
+func audit(i *discordgo.InteractionCreate, action string, result string) {
+	userID, displayName := interactionUser(i)
+	zlog.Info().Msgf("[audit] guild=%s user=%s(%s) action=%s/%s result=%s", i.GuildID, displayName, userID, cmdAdminName, action, result)
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -3,6 +3,7 @@ package bot
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,69 +12,145 @@ import (
 	"github.com/cockroachdb/errors"
 	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
 	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	"github.com/osa030/19box-discordbot/internal/spotify"
+	"github.com/osa030/19box-discordbot/internal/store"
 	"github.com/puzpuzpuz/xsync/v3"
 	zlog "github.com/rs/zerolog/log"
 )
 
 type Bot struct {
 	config       *DiscordBotConfig
-	session      *discordgo.Session
-	guildIconURL string
-	topicID      atomic.Pointer[string]
+	session      discordAPI
+	appID        atomic.Pointer[string]
+	guilds       []*guild
+	templates    *messageTemplates
+	sessionID    atomic.Pointer[string]
+	sessionState atomic.Int32 // the last v1.SessionState of the session
+	started      atomic.Bool  // whether the session has left the waiting state
+	accepting    atomic.Pointer[bool]
 	client       *jukebox.Client
+	store        store.Store
+	stateMu      sync.Mutex
+	playedTracks []store.PlayedTrack // guarded by stateMu
+	nowPlaying   nowPlaying
+	reminders    *reminders
 	errCh        chan error
 	tokens       *xsync.MapOf[string, string]
 	postedTracks *xsync.MapOf[string, bool]
-	ctx          context.Context
-	cancel       context.CancelFunc
-	wg           sync.WaitGroup
+	// requestCounts counts the accepted requests of each user in the
+	// session.
+	requestCounts *xsync.MapOf[string, int]
+	limiter       *rateLimiter
+	// tracks lists the tracks of album and playlist links for /req-multi,
+	// nil when no Spotify credentials are configured.
+	tracks trackLister
+	// finder looks up requested tracks: with the Spotify Web API when
+	// credentials are configured, else with oEmbed.
+	finder      trackFinder
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	receiveOnce sync.Once
 }
 
 func NewBot(
 	cfg *DiscordBotConfig,
 	client *jukebox.Client,
+	st store.Store,
 ) (*Bot, error) {
 	dg, err := discordgo.New("Bot " + cfg.Token)
 	if err != nil {
 		return nil, err
 	}
 
-	b := &Bot{
-		config:       cfg,
-		session:      dg,
-		client:       client,
-		errCh:        make(chan error, 1),
-		tokens:       xsync.NewMapOf[string, string](),
-		postedTracks: xsync.NewMapOf[string, bool](),
+	b, err := newBot(cfg, dg, client, st)
+	if err != nil {
+		return nil, err
 	}
 
-	b.session.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
-		b.handleCommand(s, i)
+	dg.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		b.handleCommand(i)
+	})
+	dg.Identify.Intents = discordgo.IntentsGuilds
+	dg.AddHandler(func(s *discordgo.Session, event *discordgo.Ready) {
+		b.onReady(event)
 	})
-	b.session.Identify.Intents = discordgo.IntentsGuilds
-	b.session.AddHandler(b.onReady)
 
 	return b, nil
 }
 
-func (b *Bot) onReady(s *discordgo.Session, event *discordgo.Ready) {
-	zlog.Info().Msgf("Logged in as: %v#%v", s.State.User.Username, s.State.User.Discriminator)
-	guild, err := b.session.Guild(b.config.GuildID)
+// newBot creates a Bot talking to Discord through session. Discord event
+// handlers are wired by the caller.
+func newBot(
+	cfg *DiscordBotConfig,
+	session discordAPI,
+	client *jukebox.Client,
+	st store.Store,
+) (*Bot, error) {
+	templates, err := parseMessageTemplates(cfg.Templates)
 	if err != nil {
-		zlog.Error().Msgf("Error getting guild: %v", err)
-		b.handleError(err)
-		return
+		return nil, err
+	}
+
+	b := &Bot{
+		config:        cfg,
+		session:       session,
+		templates:     templates,
+		client:        client,
+		store:         st,
+		errCh:         make(chan error, 1),
+		tokens:        xsync.NewMapOf[string, string](),
+		postedTracks:  xsync.NewMapOf[string, bool](),
+		requestCounts: xsync.NewMapOf[string, int](),
+		reminders:     newReminders(),
+	}
+	if limits := cfg.RateLimit; limits.Burst > 0 {
+		b.limiter = newRateLimiter(limits.Burst, limits.Interval)
+	}
+	b.finder = spotify.NewOEmbedClient()
+	if cfg.Spotify.ClientID != "" {
+		client := spotify.NewClient(cfg.Spotify.ClientID, cfg.Spotify.ClientSecret)
+		b.tracks = client
+		b.finder = client
+	}
+	for _, guildConfig := range cfg.GuildConfigs() {
+		g := &guild{
+			config: guildConfig,
+			locale: guildConfig.Locale,
+		}
+		if g.locale == "" {
+			g.locale = b.defaultLocale()
+		}
+		b.guilds = append(b.guilds, g)
+	}
+	if err := b.loadHistory(); err != nil {
+		return nil, errors.Wrap(err, "error loading track history")
+	}
+
+	return b, nil
+}
+
+func (b *Bot) onReady(event *discordgo.Ready) {
+	zlog.Info().Msgf("Logged in as: %v#%v", event.User.Username, event.User.Discriminator)
+	b.setAppID(event.User.ID)
+	for _, g := range b.guilds {
+		guild, err := b.session.Guild(g.config.GuildID)
+		if err != nil {
+			zlog.Error().Msgf("Error getting guild[%s]: %v", g.config.GuildID, err)
+			b.handleError(err)
+			return
+		}
+		g.setIconURL(guild.IconURL("1024"))
+		zlog.Info().Msgf("Guild[%s] icon URL: %s", guild.Name, g.getIconURL())
 	}
-	b.guildIconURL = guild.IconURL("1024")
-	zlog.Info().Msgf("Guild icon URL: %s", b.guildIconURL)
 
-	if err := s.UpdateStatusComplex(discordgo.UpdateStatusData{
+	if err := b.session.UpdateStatusComplex(discordgo.UpdateStatusData{
 		Status: "online",
 		Activities: []*discordgo.Activity{
 			{
 				Name:  msgActivityName,
 				Type:  discordgo.ActivityTypeListening,
-				State: msgActivityState,
+				State: tr(b.defaultLocale(), msgActivityState),
 			},
 		},
 	}); err != nil {
@@ -83,8 +160,18 @@ func (b *Bot) onReady(s *discordgo.Session, event *discordgo.Ready) {
 		zlog.Error().Msgf("Error registering command: %v", err)
 	}
 	zlog.Info().Msgf("Logged in done!")
-	go b.receiveNotifications()
-	zlog.Info().Msgf("Notifications received started.")
+
+	// Ready is dispatched again whenever discordgo reconnects the gateway,
+	// so only the first one starts receiving notifications.
+	b.receiveOnce.Do(func() {
+		b.wg.Add(1)
+		go b.receiveNotifications()
+		zlog.Info().Msgf("Notifications received started.")
+		if b.config.LiveNowPlaying {
+			b.wg.Add(1)
+			go b.refreshNowPlaying()
+		}
+	})
 
 }
 
@@ -93,17 +180,12 @@ func (b *Bot) Start() error {
 
 	b.ctx, b.cancel = context.WithCancel(context.Background())
 
-	err := b.client.Subscribe(b.ctx)
-	if err != nil {
-		zlog.Error().Msgf("Error subscribing to notifications: %v", err)
-		return errors.Wrap(err, "error subscribing to notifications")
-	}
+	b.client.Subscribe(b.ctx)
 
 	return b.session.Open()
 }
 
 func (b *Bot) receiveNotifications() {
-	b.wg.Add(1)
 	defer b.wg.Done()
 	zlog.Info().Msg("Receiving notifications...")
 	defer zlog.Info().Msg("Stopped receiving notifications")
@@ -118,6 +200,10 @@ func (b *Bot) receiveNotifications() {
 				return
 			}
 			zlog.Info().Msgf("Received notification: %v", notification.Type)
+			if notification.Session.GetSessionId() != "" {
+				b.attachSession(notification.Session.GetSessionId())
+				b.updateAccepting(notification.Session)
+			}
 			switch notification.Type {
 			case jukebox.NotificationTypeSessionStart:
 				b.handleSessionStart(notification)
@@ -125,6 +211,18 @@ func (b *Bot) receiveNotifications() {
 				b.handleSessionEnd(notification)
 			case jukebox.NotificationTypeTrackStart:
 				b.handleTrackStart(notification)
+			case jukebox.NotificationTypeTrackUpdate:
+				b.handleTrackUpdate(notification)
+			case jukebox.NotificationTypeSessionPaused,
+				jukebox.NotificationTypeSessionWaitingForTracks,
+				jukebox.NotificationTypeSessionEnding:
+				b.handleSessionStateChange(notification)
+			case jukebox.NotificationTypeSessionWaiting:
+				b.handleSessionWaiting(notification)
+			case jukebox.NotificationTypeSequenceGap:
+				b.handleResync(notification)
+			case jukebox.NotificationTypeStreamReconnecting:
+				zlog.Warn().Msgf("Notification stream lost, reconnecting: %v", notification.Error)
 			case jukebox.NotificationTypeStreamClosed,
 				jukebox.NotificationTypeStreamError:
 				zlog.Error().Msgf("Error receiving notification: %v", notification.Error)
@@ -135,22 +233,47 @@ func (b *Bot) receiveNotifications() {
 		}
 	}
 }
+
+// handleSessionStart creates the session topic in every guild that has none
+// yet, and posts the current track unless it has already been posted. A topic
+// created while the session was waiting gets the start message instead. It is
+// also called with the initial state of a resumed stream, in which case the
+// existing topics are kept and only a missed track is posted.
 func (b *Bot) handleSessionStart(notification *jukebox.Notification) {
-	if b.getTopicID() != "" {
-		return
-	}
+	sessionInfo := notification.Session
+	b.reminders.stop()
+	wasWaiting := v1.SessionState(b.sessionState.Load()) == v1.SessionState_SESSION_STATE_WAITING
+	b.swapSessionState(sessionInfo.GetState())
+	for _, g := range b.guilds {
+		topicID := g.getTopicID()
+		if topicID != "" && !wasWaiting {
+			continue
+		}
 
-	// create topic name
-	now := time.Now().Format(timeFormatTopicTitle)
-	topicTitle := fmt.Sprintf(msgSessionStartTitle, now)
-	zlog.Info().Msgf("Creating new topic[%s]", topicTitle)
+		sessionEndTime := formatSessionEnd(g.locale, sessionInfo.ScheduledEndTime)
+		content := tr(g.locale, msgSessionStartBody, sessionEndTime)
+		topicMessage := createSessionMessage(content, sessionInfo, g.getIconURL())
+		topicMessage = b.templates.sessionStart.apply(topicMessage, newTemplateData(g.locale, notification.Track, sessionInfo))
 
-	sessionInfo := notification.Session
-	sessionEndTime := formatSessionEnd(sessionInfo.ScheduledEndTime)
-	content := fmt.Sprintf(msgSessionStartBody, sessionEndTime)
-	topicMessage := createSessionMessage(content, sessionInfo, b.guildIconURL)
-	if err := b.createForumTopic(topicTitle, topicMessage); err != nil {
-		zlog.Error().Msgf("Error creating forum topic: %v", err)
+		if topicID != "" {
+			zlog.Info().Msgf("Starting session in topic[%s] of guild[%s]", topicID, g.config.GuildID)
+			if err := b.sendToTopic(topicID, topicMessage); err != nil {
+				zlog.Error().Msgf("Error sending message to topic: %v", err)
+			}
+		} else {
+			// create topic name
+			now := time.Now().Format(timeFormatTopicTitle)
+			topicTitle := fmt.Sprintf(msgSessionStartTitle, now)
+			zlog.Info().Msgf("Creating new topic[%s] in guild[%s]", topicTitle, g.config.GuildID)
+
+			if err := b.createForumTopic(g, topicTitle, topicMessage); err != nil {
+				zlog.Error().Msgf("Error creating forum topic: %v", err)
+			}
+		}
+
+		if err := b.startEvent(g, sessionInfo); err != nil {
+			zlog.Error().Msgf("Error starting scheduled event: %v", err)
+		}
 	}
 
 	trackInfo := notification.Track
@@ -163,17 +286,145 @@ func (b *Bot) handleSessionStart(notification *jukebox.Notification) {
 }
 
 func (b *Bot) handleSessionEnd(notification *jukebox.Notification) {
-	if b.getTopicID() == "" {
+	defer b.endSession()
+	if err := b.endEvents(b.started.Load()); err != nil {
+		zlog.Error().Msgf("Error ending scheduled events: %v", err)
+	}
+	if b.config.LiveNowPlaying {
+		if err := b.endNowPlaying(); err != nil {
+			zlog.Error().Msgf("Error ending now playing: %v", err)
+		}
+	}
+	if !b.hasTopic() {
 		return
 	}
 
 	sessionInfo := notification.Session
-	topicMessage := createSessionMessage(msgSessionEndBody, sessionInfo, b.guildIconURL)
-	if err := b.sendToTopic(topicMessage); err != nil {
+	err := b.sendToTopics(func(g *guild) *discordgo.MessageSend {
+		msg := createSessionMessage(tr(g.locale, msgSessionEndBody), sessionInfo, g.getIconURL())
+		return b.templates.sessionEnd.apply(msg, newTemplateData(g.locale, nil, sessionInfo))
+	})
+	if err != nil {
 		zlog.Error().Msgf("Error sending message to topic: %v", err)
 	}
-	b.setTopicID("")
+	if err := b.postRecap(); err != nil {
+		zlog.Error().Msgf("Error sending recap to topic: %v", err)
+	}
+}
+
+// postRecap sends the set list of the session to the topics, one page per
+// message.
+func (b *Bot) postRecap() error {
+	tracks := b.getPlayedTracks()
+	var errs []error
+	for page := range recapPages(len(tracks)) {
+		err := b.sendToTopics(func(g *guild) *discordgo.MessageSend {
+			return createRecapMessage(g.locale, tracks, page)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleSessionStateChange posts a status line to the topics when the
+// session moves to a state where nothing plays, so listeners know why the
+// music stopped.
+func (b *Bot) handleSessionStateChange(notification *jukebox.Notification) {
+	state := notification.Session.GetState()
+	if !b.swapSessionState(state) || !b.hasTopic() {
+		return
+	}
+	line, ok := sessionStateLines[state]
+	if !ok {
+		return
+	}
+	zlog.Info().Msgf("Session state changed: %v", state)
+	err := b.sendToTopics(func(g *guild) *discordgo.MessageSend {
+		return &discordgo.MessageSend{Content: tr(g.locale, line)}
+	})
+	if err != nil {
+		zlog.Error().Msgf("Error sending session state to topic: %v", err)
+	}
+}
+
+// updateAccepting records whether the session accepts requests and
+// announces in the topics when that flips. Closing is not announced when the
+// session is ending, as the state line already says so.
+func (b *Bot) updateAccepting(sessionInfo *v1.SessionInfo) {
+	accepting := sessionInfo.AcceptingRequests
+	previous := b.accepting.Swap(&accepting)
+	if previous == nil || *previous == accepting || !b.hasTopic() {
+		return
+	}
+	switch sessionInfo.State {
+	case v1.SessionState_SESSION_STATE_ENDING, v1.SessionState_SESSION_STATE_TERMINATED:
+		return
+	}
+
+	zlog.Info().Msgf("Accepting requests changed: %v", accepting)
+	line := msgRequestsClosedLine
+	if accepting {
+		line = msgRequestsOpenedLine
+	}
+	err := b.sendToTopics(func(g *guild) *discordgo.MessageSend {
+		return &discordgo.MessageSend{Content: tr(g.locale, line)}
+	})
+	if err != nil {
+		zlog.Error().Msgf("Error sending accepting requests to topic: %v", err)
+	}
+}
+
+// isAccepting reports whether the session accepts requests, assuming it
+// does until a notification says otherwise.
+func (b *Bot) isAccepting() bool {
+	if p := b.accepting.Load(); p != nil {
+		return *p
+	}
+	return true
+}
+
+// swapSessionState records state as the state of the session and reports
+// whether it changed. A session seen past the waiting state is marked as
+// started.
+func (b *Bot) swapSessionState(state v1.SessionState) bool {
+	switch state {
+	case v1.SessionState_SESSION_STATE_RUNNING,
+		v1.SessionState_SESSION_STATE_PAUSED,
+		v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS,
+		v1.SessionState_SESSION_STATE_ENDING:
+		if !b.started.Swap(true) {
+			b.saveState()
+		}
+	}
+	return b.sessionState.Swap(int32(state)) != int32(state)
+}
+
+// endSession forgets the current session and its stored state.
+func (b *Bot) endSession() {
+	b.clearSession(b.getSessionID())
+	b.setSessionID("")
+}
+
+// clearSession deletes the stored state of sessionID and forgets the state
+// kept for it in memory, including the listener IDs joined in it.
+func (b *Bot) clearSession(sessionID string) {
+	if sessionID != "" {
+		if err := b.store.Delete(sessionID); err != nil {
+			zlog.Error().Msgf("Error deleting session state: %v", err)
+		}
+	}
+	b.reminders.stop()
+	b.clearTopics()
+	b.tokens.Clear()
 	b.postedTracks.Clear()
+	b.requestCounts.Clear()
+	b.setPlayedTracks(nil)
+	b.nowPlaying.clear()
+	b.sessionState.Store(int32(v1.SessionState_SESSION_STATE_UNSPECIFIED))
+	b.started.Store(false)
+	b.accepting.Store(nil)
 }
 
 func (b *Bot) handleTrackStart(notification *jukebox.Notification) {
@@ -187,16 +438,57 @@ func (b *Bot) handleTrackStart(notification *jukebox.Notification) {
 	}
 }
 
+// handleResync catches up with the state fetched from the server after
+// notifications were missed.
+func (b *Bot) handleResync(notification *jukebox.Notification) {
+	zlog.Warn().Msgf("Resyncing state after notification gap: %v", notification.Error)
+	switch notification.Session.GetState() {
+	case v1.SessionState_SESSION_STATE_WAITING:
+		b.handleSessionWaiting(notification)
+	case v1.SessionState_SESSION_STATE_RUNNING:
+		b.handleSessionStart(notification)
+	case v1.SessionState_SESSION_STATE_PAUSED,
+		v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS,
+		v1.SessionState_SESSION_STATE_ENDING:
+		b.handleSessionStateChange(notification)
+		// an ending session still plays out the queue, and a track already
+		// posted is not posted again
+		if notification.Track != nil {
+			if err := b.postNowplaying(notification.Track, notification.Session); err != nil {
+				zlog.Error().Msgf("Error posting now playing: %v", err)
+			}
+		}
+	case v1.SessionState_SESSION_STATE_TERMINATED:
+		b.handleSessionEnd(notification)
+	}
+}
+
 func (b *Bot) postNowplaying(trackInfo *v1.TrackInfo, sessionInfo *v1.SessionInfo) error {
 
 	trackID := trackInfo.TrackId
-	if _, loaded := b.postedTracks.LoadOrStore(trackID, true); loaded {
+	_, loaded := b.postedTracks.LoadOrStore(trackID, true)
+	if !loaded {
+		b.recordTrack(trackInfo)
+		b.recordHistory(trackInfo)
+		b.saveState()
+	}
+
+	if b.config.LiveNowPlaying {
+		// a track already posted is shown again, so that the live message
+		// is picked up after a restart
+		b.nowPlaying.update(trackInfo, sessionInfo)
+		return b.showNowPlaying()
+	}
+	if loaded {
 		zlog.Warn().Msgf("Track already posted: %s", trackID)
 		return nil
 	}
 
-	msg := createNowPlayingMessage(trackInfo, sessionInfo)
-	if err := b.sendToTopic(msg); err != nil {
+	err := b.sendToTopics(func(g *guild) *discordgo.MessageSend {
+		msg := createNowPlayingMessage(g.locale, trackInfo, sessionInfo)
+		return b.templates.nowPlaying.apply(msg, newTemplateData(g.locale, trackInfo, sessionInfo))
+	})
+	if err != nil {
 		zlog.Error().Msgf("Error sending now playing to topic: %v", err)
 		return err
 	}
@@ -209,6 +501,7 @@ func (b *Bot) Stop() {
 	if b.cancel != nil {
 		b.cancel()
 	}
+	b.reminders.stop()
 
 	err := b.unregisterCommands()
 	if err != nil {
@@ -243,9 +536,22 @@ func (b *Bot) responseUpdate(i *discordgo.InteractionCreate, content string) {
 	}
 }
 
-func (b *Bot) createForumTopic(title string, message *discordgo.MessageSend) error {
+func (b *Bot) responseUpdateMessage(i *discordgo.InteractionCreate, message *discordgo.MessageSend) {
+	edit := &discordgo.WebhookEdit{
+		Content: &message.Content,
+	}
+	if message.Embed != nil {
+		edit.Embeds = &[]*discordgo.MessageEmbed{message.Embed}
+	}
+	_, err := b.session.InteractionResponseEdit(i.Interaction, edit)
+	if err != nil {
+		zlog.Error().Msgf("Error response update: %v", err)
+	}
+}
+
+func (b *Bot) createForumTopic(g *guild, title string, message *discordgo.MessageSend) error {
 	s := b.session
-	thread, err := s.ForumThreadStartComplex(b.config.ForumID, &discordgo.ThreadStart{
+	thread, err := s.ForumThreadStartComplex(g.config.ForumID, &discordgo.ThreadStart{
 		Name:                title,
 		AutoArchiveDuration: 1440, // 24時間
 	}, message)
@@ -254,17 +560,34 @@ func (b *Bot) createForumTopic(title string, message *discordgo.MessageSend) err
 		zlog.Error().Msgf("Error creating forum topic: %v", err)
 		return err
 	}
-	b.setTopicID(thread.ID)
+	g.setTopicID(thread.ID)
+	b.saveState()
 	zlog.Info().Msgf("Created forum topic: %s (ID: %s)", thread.Name, thread.ID)
 	return nil
 }
 
-func (b *Bot) sendToTopic(message *discordgo.MessageSend) error {
-	topicID := b.getTopicID()
-	if topicID == "" {
+// sendToTopics sends the message built by build to the topic of every guild
+// that has one.
+func (b *Bot) sendToTopics(build func(g *guild) *discordgo.MessageSend) error {
+	var errs []error
+	sent := false
+	for _, g := range b.guilds {
+		topicID := g.getTopicID()
+		if topicID == "" {
+			continue
+		}
+		sent = true
+		if err := b.sendToTopic(topicID, build(g)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !sent {
 		return errors.New("topicID is not set")
 	}
+	return errors.Join(errs...)
+}
 
+func (b *Bot) sendToTopic(topicID string, message *discordgo.MessageSend) error {
 	s := b.session
 	msg, err := s.ChannelMessageSendComplex(topicID, message)
 	if err != nil {
@@ -275,13 +598,156 @@ func (b *Bot) sendToTopic(message *discordgo.MessageSend) error {
 	return nil
 }
 
-func (b *Bot) getTopicID() string {
-	if p := b.topicID.Load(); p != nil {
+func (b *Bot) getAppID() string {
+	if p := b.appID.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+func (b *Bot) setAppID(id string) {
+	b.appID.Store(&id)
+}
+
+func (b *Bot) getSessionID() string {
+	if p := b.sessionID.Load(); p != nil {
 		return *p
 	}
 	return ""
 }
 
-func (b *Bot) setTopicID(id string) {
-	b.topicID.Store(&id)
+func (b *Bot) setSessionID(id string) {
+	b.sessionID.Store(&id)
+}
+
+// attachSession switches the bot to sessionID. When the bot has no session
+// yet (i.e. right after a restart) the stored state of sessionID is restored,
+// so a running session keeps its topic and its listener IDs.
+func (b *Bot) attachSession(sessionID string) {
+	previous := b.getSessionID()
+	if previous == sessionID {
+		return
+	}
+	b.setSessionID(sessionID)
+
+	if previous != "" {
+		zlog.Info().Msgf("Session changed from [%s] to [%s]", previous, sessionID)
+		b.clearSession(previous)
+		return
+	}
+
+	state, err := b.store.Load(sessionID)
+	if err != nil {
+		zlog.Error().Msgf("Error loading session state: %v", err)
+		return
+	}
+	if state == nil {
+		return
+	}
+	zlog.Info().Msgf("Restoring session [%s] state: topics(%d) tokens(%d) posted tracks(%d) played tracks(%d)", sessionID, len(state.TopicIDs), len(state.Tokens), len(state.PostedTracks), len(state.PlayedTracks))
+	for guildID, topicID := range state.TopicIDs {
+		if g := b.guild(guildID); g != nil {
+			g.setTopicID(topicID)
+		}
+	}
+	for guildID, messageID := range state.NowPlayingIDs {
+		if g := b.guild(guildID); g != nil {
+			g.setNowPlayingID(messageID)
+		}
+	}
+	for guildID, eventID := range state.EventIDs {
+		if g := b.guild(guildID); g != nil {
+			g.setEventID(eventID)
+		}
+	}
+	for userID, token := range state.Tokens {
+		b.tokens.Store(userID, token)
+	}
+	for _, trackID := range state.PostedTracks {
+		b.postedTracks.Store(trackID, true)
+	}
+	for userID, count := range state.RequestCounts {
+		b.requestCounts.Store(userID, count)
+	}
+	b.setPlayedTracks(state.PlayedTracks)
+	b.started.Store(state.Started)
+	if !state.Started && state.SessionID == sessionID {
+		// the session was saved while waiting to start, so its start is
+		// still to be announced in the restored topics
+		b.sessionState.Store(int32(v1.SessionState_SESSION_STATE_WAITING))
+	}
+}
+
+// recordTrack appends trackInfo to the set list of the session.
+func (b *Bot) recordTrack(trackInfo *v1.TrackInfo) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.playedTracks = append(b.playedTracks, store.PlayedTrack{
+		TrackID:         trackInfo.TrackId,
+		Name:            trackInfo.Name,
+		Artists:         trackInfo.Artists,
+		URL:             trackInfo.Url,
+		RequesterName:   trackInfo.RequesterName,
+		RequesterUserID: trackInfo.RequesterExternalUserId,
+		StartedAt:       time.Now(),
+	})
+}
+
+func (b *Bot) getPlayedTracks() []store.PlayedTrack {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	return slices.Clone(b.playedTracks)
+}
+
+func (b *Bot) setPlayedTracks(tracks []store.PlayedTrack) {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	b.playedTracks = tracks
+}
+
+// saveState writes the state of the current session to the store.
+func (b *Bot) saveState() {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+
+	sessionID := b.getSessionID()
+	if sessionID == "" {
+		return
+	}
+	state := &store.SessionState{
+		SessionID:     sessionID,
+		Started:       b.started.Load(),
+		TopicIDs:      map[string]string{},
+		NowPlayingIDs: map[string]string{},
+		EventIDs:      map[string]string{},
+		Tokens:        map[string]string{},
+		RequestCounts: map[string]int{},
+		PlayedTracks:  slices.Clone(b.playedTracks),
+	}
+	for _, g := range b.guilds {
+		if topicID := g.getTopicID(); topicID != "" {
+			state.TopicIDs[g.config.GuildID] = topicID
+		}
+		if messageID := g.getNowPlayingID(); messageID != "" {
+			state.NowPlayingIDs[g.config.GuildID] = messageID
+		}
+		if eventID := g.getEventID(); eventID != "" {
+			state.EventIDs[g.config.GuildID] = eventID
+		}
+	}
+	b.tokens.Range(func(userID string, token string) bool {
+		state.Tokens[userID] = token
+		return true
+	})
+	b.postedTracks.Range(func(trackID string, _ bool) bool {
+		state.PostedTracks = append(state.PostedTracks, trackID)
+		return true
+	})
+	b.requestCounts.Range(func(userID string, count int) bool {
+		state.RequestCounts[userID] = count
+		return true
+	})
+	if err := b.store.Save(state); err != nil {
+		zlog.Error().Msgf("Error saving session state: %v", err)
+	}
 }
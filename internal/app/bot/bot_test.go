@@ -0,0 +1,1434 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+	"github.com/osa030/19box-discordbot/internal/app/bot/discordtest"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	"github.com/osa030/19box-discordbot/internal/jukebox/jukeboxtest"
+	"github.com/osa030/19box-discordbot/internal/spotify"
+	"github.com/osa030/19box-discordbot/internal/store"
+	"github.com/rs/zerolog"
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	testGuildID = "guild"
+	testForumID = "forum"
+	testAppID   = "app"
+)
+
+type testBot struct {
+	*Bot
+	discord *discordtest.Recorder
+	server  *jukeboxtest.Server
+	store   *store.MemoryStore
+}
+
+func newTestBot(t *testing.T, opts ...func(cfg *DiscordBotConfig)) *testBot {
+	t.Helper()
+	cfg := &DiscordBotConfig{
+		Token:   "token",
+		GuildID: testGuildID,
+		ForumID: testForumID,
+		Locale:  localeJa,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	tb := &testBot{
+		discord: discordtest.NewRecorder(),
+		server:  jukeboxtest.NewServer(t),
+		store:   store.NewMemoryStore(),
+	}
+	b, err := newBot(cfg, tb.discord, jukebox.NewClient(tb.server.URL, 0), tb.store)
+	if err != nil {
+		t.Fatalf("newBot: %v", err)
+	}
+	tb.Bot = b
+	// tests look up no track unless they set a finder
+	tb.finder = fakeTrackLister{}
+	return tb
+}
+
+// start connects the bot as if Discord had sent Ready, and stops it at the
+// end of the test. Notifications must be queued on the server beforehand.
+func (tb *testBot) start(t *testing.T) {
+	t.Helper()
+	if err := tb.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	tb.onReady(&discordgo.Ready{User: &discordgo.User{ID: testAppID, Username: "19box"}})
+	t.Cleanup(tb.Stop)
+}
+
+// waitFor waits until cond holds, re-checking it on every Discord API call.
+func (tb *testBot) waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		changed := tb.discord.Changed()
+		if cond() {
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func newCommand(id string, userID string, name string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	return &discordgo.InteractionCreate{
+		Interaction: &discordgo.Interaction{
+			ID:      id,
+			Type:    discordgo.InteractionApplicationCommand,
+			GuildID: testGuildID,
+			Member: &discordgo.Member{
+				User: &discordgo.User{ID: userID, Username: "user " + userID},
+			},
+			Data: discordgo.ApplicationCommandInteractionData{
+				Name:    name,
+				Options: options,
+			},
+		},
+	}
+}
+
+func urlOption(url string) *discordgo.ApplicationCommandInteractionDataOption {
+	return &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  cmdOptionURLName,
+		Type:  discordgo.ApplicationCommandOptionString,
+		Value: url,
+	}
+}
+
+func TestSessionFlow(t *testing.T) {
+	tb := newTestBot(t)
+	session := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+	session.Keywords = []string{"city pop"}
+	t1 := jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_PLAYING)
+	t1.RequesterExternalUserId = "u1"
+	t2 := jukeboxtest.Track("t2", v1.TrackState_TRACK_STATE_STARTED)
+	t2.RequesterName = "bob"
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, session, t1),
+		jukeboxtest.ChangeTrack(2, session, t2),
+		jukeboxtest.ChangeTrack(3, session, t2),
+		jukeboxtest.ChangeState(4, jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_TERMINATED), nil),
+	)
+	tb.start(t)
+
+	tb.waitFor(t, "session end", func() bool {
+		return len(tb.discord.Messages("")) == 4 && tb.getSessionID() == ""
+	})
+
+	commands := tb.discord.Commands(testGuildID)
+	if len(commands) != 5 {
+		t.Errorf("registered commands = %d, want 5", len(commands))
+	}
+	if !slices.ContainsFunc(commands, func(cmd *discordgo.ApplicationCommand) bool {
+		return cmd.Name == cmdRequestMessageName && cmd.Type == discordgo.MessageApplicationCommand
+	}) {
+		t.Errorf("commands = %v, want the message command", commands)
+	}
+
+	threads := tb.discord.Threads()
+	if len(threads) != 1 {
+		t.Fatalf("threads = %d, want 1", len(threads))
+	}
+	thread := threads[0]
+	if thread.ForumID != testForumID || !strings.HasPrefix(thread.Name, "🎵 session(") {
+		t.Errorf("thread = %s in %s", thread.Name, thread.ForumID)
+	}
+	if want := tr(localeJa, msgSessionStartBody, tr(localeJa, msgTimeUndetermined)); thread.Message.Content != want {
+		t.Errorf("session start content = %q, want %q", thread.Message.Content, want)
+	}
+	if thread.Message.Embed.Title != "🎶 playlist s1" || thread.Message.Embed.URL != session.PlaylistUrl {
+		t.Errorf("session start embed = %s %s", thread.Message.Embed.Title, thread.Message.Embed.URL)
+	}
+
+	messages := tb.discord.Messages(thread.ID)
+	if len(messages) != 4 {
+		t.Fatalf("messages in thread = %d, want 4", len(messages))
+	}
+	nowPlaying := []struct {
+		title   string
+		content string
+	}{
+		{"🎵 track t1", tr(localeJa, msgNowPlayingBody, "track t1", "artist t1", "selected by <@u1>")},
+		{"🎵 track t2", tr(localeJa, msgNowPlayingBody, "track t2", "artist t2", "selected by bob")},
+	}
+	for n, want := range nowPlaying {
+		msg := messages[n].Message
+		if msg.Content != want.content || msg.Embed.Title != want.title {
+			t.Errorf("message %d = %q %q, want %q %q", n, msg.Embed.Title, msg.Content, want.title, want.content)
+		}
+		if len(msg.Embed.Fields) != 1 || msg.Embed.Fields[0].Value != "city pop" {
+			t.Errorf("message %d fields = %v, want keyword", n, msg.Embed.Fields)
+		}
+	}
+	if got, want := messages[2].Message.Content, tr(localeJa, msgSessionEndBody); got != want {
+		t.Errorf("session end content = %q, want %q", got, want)
+	}
+	recap := messages[3].Message.Embed
+	if want := "📜 セットリスト (1/1)"; recap.Title != want {
+		t.Errorf("recap title = %q, want %q", recap.Title, want)
+	}
+	for _, want := range []string{
+		"`01` ", " [track t1](https://open.spotify.com/track/t1) / artist t1 — <@u1>\n",
+		"`02` ", " [track t2](https://open.spotify.com/track/t2) / artist t2 — bob\n",
+	} {
+		if !strings.Contains(recap.Description, want) {
+			t.Errorf("recap %q does not contain %q", recap.Description, want)
+		}
+	}
+	if len(recap.Fields) != 1 || recap.Fields[0].Value != "<@u1>: 1曲\nbob: 1曲\n" {
+		t.Errorf("recap fields = %+v", recap.Fields)
+	}
+
+	if state, _ := tb.store.Load("s1"); state != nil {
+		t.Errorf("session state not deleted: %+v", state)
+	}
+	if tb.hasTopic() {
+		t.Error("topic not cleared after session end")
+	}
+}
+
+func TestSessionStateLines(t *testing.T) {
+	tb := newTestBot(t)
+	session := func(state v1.SessionState) *v1.SessionInfo {
+		session := jukeboxtest.Session("s1", state)
+		// requests stay open until the session ends, which the ending line
+		// already announces
+		session.AcceptingRequests = state != v1.SessionState_SESSION_STATE_ENDING
+		return session
+	}
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, session(v1.SessionState_SESSION_STATE_RUNNING), nil),
+		jukeboxtest.ChangeState(2, session(v1.SessionState_SESSION_STATE_PAUSED), nil),
+		jukeboxtest.ChangeState(3, session(v1.SessionState_SESSION_STATE_RUNNING), nil),
+		jukeboxtest.ChangeState(4, session(v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS), nil),
+		jukeboxtest.ChangeState(5, session(v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS), nil),
+		jukeboxtest.ChangeState(6, session(v1.SessionState_SESSION_STATE_ENDING), nil),
+	)
+	tb.start(t)
+
+	tb.waitFor(t, "state lines", func() bool {
+		return len(tb.discord.Messages("")) == 3
+	})
+	var got []string
+	for _, m := range tb.discord.Messages("") {
+		got = append(got, m.Message.Content)
+	}
+	want := []string{
+		"⏸️ 一時停止中",
+		"⏳ リクエスト待ち — /req で曲を追加してください",
+		"🔚 受付終了",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("state lines = %q, want %q", got, want)
+	}
+}
+
+// fakeReminders makes the reminders of tb run on a clock stopped at now, and
+// sends each scheduled reminder to the returned channel instead of starting a
+// timer.
+func fakeReminders(tb *testBot, now time.Time) <-chan *fakeReminder {
+	scheduled := make(chan *fakeReminder, 10)
+	tb.reminders.now = func() time.Time { return now }
+	tb.reminders.afterFunc = func(d time.Duration, f func()) func() bool {
+		r := &fakeReminder{delay: d, fire: f}
+		scheduled <- r
+		return func() bool { return !r.stopped.Swap(true) }
+	}
+	return scheduled
+}
+
+type fakeReminder struct {
+	delay   time.Duration
+	fire    func()
+	stopped atomic.Bool
+}
+
+func TestScheduledSession(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		// the first reminder is already due when the session is announced
+		cfg.Reminders = []time.Duration{time.Hour, 15 * time.Minute, 5 * time.Minute}
+	})
+	now := time.Date(2026, 1, 2, 20, 0, 0, 0, time.Local)
+	scheduled := fakeReminders(tb, now)
+	start := now.Add(30 * time.Minute)
+	session := func(state v1.SessionState) *v1.SessionInfo {
+		session := jukeboxtest.Session("s1", state)
+		session.ScheduledStartTime = start.Format(time.RFC3339)
+		session.AcceptingRequests = true
+		return session
+	}
+	tb.server.Notify(jukeboxtest.InitialState(1, session(v1.SessionState_SESSION_STATE_WAITING), nil))
+	tb.start(t)
+
+	var reminders []*fakeReminder
+	for range 2 {
+		select {
+		case r := <-scheduled:
+			reminders = append(reminders, r)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for reminders, got %d", len(reminders))
+		}
+	}
+	if reminders[0].delay != 15*time.Minute || reminders[1].delay != 25*time.Minute {
+		t.Errorf("reminders in %v and %v, want 15m and 25m", reminders[0].delay, reminders[1].delay)
+	}
+	threads := tb.discord.Threads()
+	if len(threads) != 1 {
+		t.Fatalf("threads = %d, want 1", len(threads))
+	}
+	want := tr(localeJa, msgSessionScheduledBody, start.Format(timeFormatDisplay), tr(localeJa, msgTimeUndetermined))
+	if got := threads[0].Message.Content; got != want {
+		t.Errorf("scheduled content = %q, want %q", got, want)
+	}
+
+	reminders[0].fire()
+	messages := tb.discord.Messages("")
+	if len(messages) != 1 {
+		t.Fatalf("messages = %d, want the reminder", len(messages))
+	}
+	if got, want := messages[0].Message.Content, tr(localeJa, msgSessionReminder, 15); got != want {
+		t.Errorf("reminder = %q, want %q", got, want)
+	}
+
+	tb.server.Notify(jukeboxtest.ChangeState(2, session(v1.SessionState_SESSION_STATE_RUNNING), nil))
+	tb.waitFor(t, "session start", func() bool {
+		return len(tb.discord.Messages("")) == 2
+	})
+	if got := len(tb.discord.Threads()); got != 1 {
+		t.Errorf("threads = %d, want the scheduled topic to be reused", got)
+	}
+	msg := tb.discord.Messages(threads[0].ID)[1].Message
+	if want := tr(localeJa, msgSessionStartBody, tr(localeJa, msgTimeUndetermined)); msg.Content != want {
+		t.Errorf("session start content = %q, want %q", msg.Content, want)
+	}
+
+	// the started session cancels the pending reminder, which stays quiet
+	// even when its timer had already fired
+	if !reminders[1].stopped.Load() {
+		t.Error("pending reminder not stopped when the session started")
+	}
+	reminders[1].fire()
+	if got := len(tb.discord.Messages("")); got != 2 {
+		t.Errorf("messages = %d, want no reminder after the start", got)
+	}
+}
+
+func TestScheduledEvents(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.ScheduledEvents = true
+	})
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	session := func(state v1.SessionState) *v1.SessionInfo {
+		session := jukeboxtest.Session("s1", state)
+		session.ScheduledStartTime = start.Format(time.RFC3339)
+		session.AcceptingRequests = true
+		return session
+	}
+	event := func() discordgo.GuildScheduledEvent {
+		events := tb.discord.Events(testGuildID)
+		if len(events) != 1 {
+			t.Fatalf("events = %d, want 1", len(events))
+		}
+		return events[0]
+	}
+	tb.server.Notify(jukeboxtest.InitialState(1, session(v1.SessionState_SESSION_STATE_WAITING), nil))
+	tb.start(t)
+
+	tb.waitFor(t, "scheduled event", func() bool {
+		return len(tb.discord.Events(testGuildID)) == 1
+	})
+	scheduled := event()
+	if scheduled.Name != "playlist s1" || !scheduled.ScheduledStartTime.Equal(start) ||
+		!scheduled.ScheduledEndTime.Equal(start.Add(defaultEventDuration)) {
+		t.Errorf("event = %s from %v to %v", scheduled.Name, scheduled.ScheduledStartTime, scheduled.ScheduledEndTime)
+	}
+	topicURL := "https://discord.com/channels/guild/" + tb.discord.Threads()[0].ID
+	if want := tr(localeJa, msgEventDescription, topicURL); scheduled.Description != want {
+		t.Errorf("event description = %q, want %q", scheduled.Description, want)
+	}
+
+	tb.server.Notify(jukeboxtest.ChangeState(2, session(v1.SessionState_SESSION_STATE_RUNNING), nil))
+	tb.waitFor(t, "active event", func() bool {
+		return event().Status == discordgo.GuildScheduledEventStatusActive
+	})
+	tb.server.Notify(jukeboxtest.ChangeState(3, session(v1.SessionState_SESSION_STATE_TERMINATED), nil))
+	tb.waitFor(t, "completed event", func() bool {
+		return event().Status == discordgo.GuildScheduledEventStatusCompleted
+	})
+}
+
+func TestScheduledEventsAfterRestart(t *testing.T) {
+	tests := []struct {
+		name    string
+		started bool
+		want    discordgo.GuildScheduledEventStatus
+	}{
+		{"never started", false, discordgo.GuildScheduledEventStatusCanceled},
+		{"started", true, discordgo.GuildScheduledEventStatusCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+				cfg.ScheduledEvents = true
+			})
+			start := time.Now().Add(time.Hour)
+			event, err := tb.discord.GuildScheduledEventCreate(testGuildID, &discordgo.GuildScheduledEventParams{
+				Name:               "playlist s1",
+				ScheduledStartTime: &start,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the bot stopped while the session was in the state saved here
+			if err := tb.store.Save(&store.SessionState{
+				SessionID: "s1",
+				Started:   tt.started,
+				EventIDs:  map[string]string{testGuildID: event.ID},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			tb.server.Notify(jukeboxtest.ChangeState(1, jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_TERMINATED), nil))
+			tb.start(t)
+
+			tb.waitFor(t, "ended event", func() bool {
+				return tb.discord.Events(testGuildID)[0].Status != discordgo.GuildScheduledEventStatusScheduled
+			})
+			if got := tb.discord.Events(testGuildID)[0].Status; got != tt.want {
+				t.Errorf("event status = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionStartAfterRestart(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.ScheduledEvents = true
+	})
+	start := time.Now().Add(time.Minute)
+	event, err := tb.discord.GuildScheduledEventCreate(testGuildID, &discordgo.GuildScheduledEventParams{
+		Name:               "playlist s1",
+		ScheduledStartTime: &start,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the bot stopped while s1 was waiting, and s1 started in the meantime
+	if err := tb.store.Save(&store.SessionState{
+		SessionID: "s1",
+		TopicIDs:  map[string]string{testGuildID: "thread-old"},
+		EventIDs:  map[string]string{testGuildID: event.ID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tb.server.Notify(jukeboxtest.InitialState(1, jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING), nil))
+	tb.start(t)
+
+	tb.waitFor(t, "session start", func() bool {
+		return len(tb.discord.Messages("thread-old")) == 1
+	})
+	if threads := tb.discord.Threads(); len(threads) != 0 {
+		t.Errorf("threads = %v, want the restored topic reused", threads)
+	}
+	if got, want := tb.discord.Messages("thread-old")[0].Message.Content, tr(localeJa, msgSessionStartBody, tr(localeJa, msgTimeUndetermined)); got != want {
+		t.Errorf("message = %q, want the session start %q", got, want)
+	}
+	if got := tb.discord.Events(testGuildID)[0].Status; got != discordgo.GuildScheduledEventStatusActive {
+		t.Errorf("event status = %v, want active", got)
+	}
+	if state, _ := tb.store.Load("s1"); state == nil || !state.Started {
+		t.Errorf("stored state = %+v, want started", state)
+	}
+}
+
+func TestAcceptingRequests(t *testing.T) {
+	tb := newTestBot(t)
+	session := func(accepting bool) *v1.SessionInfo {
+		session := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+		session.AcceptingRequests = accepting
+		return session
+	}
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, session(true), nil),
+		jukeboxtest.ChangeState(2, session(false), nil),
+	)
+	tb.start(t)
+	tb.waitFor(t, "requests closed", func() bool {
+		return len(tb.discord.Messages("")) == 1
+	})
+
+	tb.handleCommand(newRequest("r1", "u1"))
+	tb.waitFor(t, "response", func() bool {
+		return len(tb.discord.Edits()) == 1
+	})
+	if got, want := *tb.discord.Edits()[0].Edit.Content, tr(localeJa, msgRequestsClosed); got != want {
+		t.Errorf("response = %q, want %q", got, want)
+	}
+	if got := len(tb.server.Listeners()); got != 0 {
+		t.Errorf("listeners = %d, want the request to be rejected locally", got)
+	}
+
+	tb.server.Notify(jukeboxtest.ChangeState(3, session(true), nil))
+	tb.waitFor(t, "requests opened", func() bool {
+		return len(tb.discord.Messages("")) == 2
+	})
+	var got []string
+	for _, m := range tb.discord.Messages("") {
+		got = append(got, m.Message.Content)
+	}
+	want := []string{
+		"📪 リクエスト受付を停止しました",
+		"📬 リクエスト受付を開始しました — /req で曲を追加してください",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+	if !tb.isAccepting() {
+		t.Error("requests still closed")
+	}
+}
+
+func TestLiveNowPlaying(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.LiveNowPlaying = true
+	})
+	session := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+	track := func(id string, state v1.TrackState, remaining int32) *v1.TrackInfo {
+		track := jukeboxtest.Track(id, state)
+		track.RemainingSeconds = remaining
+		return track
+	}
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, session, track("t1", v1.TrackState_TRACK_STATE_PLAYING, 180)),
+		jukeboxtest.ChangeTrack(2, session, track("t1", v1.TrackState_TRACK_STATE_PAUSED, 100)),
+		jukeboxtest.ChangeTrack(3, session, track("t1", v1.TrackState_TRACK_STATE_SKIPPED, 100)),
+		jukeboxtest.ChangeTrack(4, session, track("t2", v1.TrackState_TRACK_STATE_STARTED, 240)),
+	)
+	tb.start(t)
+
+	tb.waitFor(t, "now playing edits", func() bool {
+		threads := tb.discord.Threads()
+		return len(threads) == 1 && len(tb.discord.MessageEdits(threads[0].ID)) == 3
+	})
+	topicID := tb.discord.Threads()[0].ID
+
+	messages := tb.discord.Messages(topicID)
+	if len(messages) != 1 {
+		t.Fatalf("messages in thread = %d, want only the now playing message", len(messages))
+	}
+	nowPlayingID := messages[0].ID
+	if pins := tb.discord.Pins(topicID); len(pins) != 1 || pins[0] != nowPlayingID {
+		t.Errorf("pins = %v, want [%s]", pins, nowPlayingID)
+	}
+	fields := func(embed *discordgo.MessageEmbed) []string {
+		var values []string
+		for _, field := range embed.Fields {
+			values = append(values, field.Value)
+		}
+		return values
+	}
+	if got, want := fields(messages[0].Message.Embed), []string{"▶️ 再生中", "▱▱▱▱▱▱▱▱▱▱▱▱ 0:00 / 3:00"}; !slices.Equal(got, want) {
+		t.Errorf("posted fields = %q, want %q", got, want)
+	}
+
+	edits := tb.discord.MessageEdits(topicID)
+	want := []struct {
+		title  string
+		fields []string
+	}{
+		{"🎵 track t1", []string{"⏸️ 一時停止中", "▰▰▰▰▰▱▱▱▱▱▱▱ 1:20 / 3:00"}},
+		{"🎵 track t1", []string{"⏭️ スキップされました", "▰▰▰▰▰▱▱▱▱▱▱▱ 1:20 / 3:00"}},
+		{"🎵 track t2", []string{"▶️ 再生中", "▱▱▱▱▱▱▱▱▱▱▱▱ 0:00 / 4:00"}},
+	}
+	for n, edit := range edits {
+		if edit.ID != nowPlayingID {
+			t.Errorf("edit %d of %s, want %s", n, edit.ID, nowPlayingID)
+		}
+		embed := (*edit.Embeds)[0]
+		if embed.Title != want[n].title || !slices.Equal(fields(embed), want[n].fields) {
+			t.Errorf("edit %d = %s %q, want %s %q", n, embed.Title, fields(embed), want[n].title, want[n].fields)
+		}
+	}
+
+	if state, _ := tb.store.Load("s1"); state == nil || state.NowPlayingIDs[testGuildID] != nowPlayingID {
+		t.Errorf("stored state = %+v, want now playing message %s", state, nowPlayingID)
+	}
+
+	// a deleted message is posted again
+	tb.discord.DeleteMessage(nowPlayingID)
+	tb.nowPlaying.update(track("t2", v1.TrackState_TRACK_STATE_PAUSED, 200), session)
+	if err := tb.showNowPlaying(); err != nil {
+		t.Fatalf("showNowPlaying: %v", err)
+	}
+	if messages := tb.discord.Messages(topicID); len(messages) != 1 || messages[0].ID == nowPlayingID {
+		t.Errorf("messages after delete = %+v, want a new now playing message", messages)
+	}
+}
+
+func TestLiveNowPlayingSessionEnd(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.LiveNowPlaying = true
+	})
+	track := jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_PLAYING)
+	track.RemainingSeconds = 180
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING), track),
+		jukeboxtest.ChangeState(2, jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_TERMINATED), nil),
+	)
+	tb.start(t)
+
+	tb.waitFor(t, "session end", func() bool {
+		return tb.getSessionID() == "" && len(tb.discord.Threads()) == 1
+	})
+	topicID := tb.discord.Threads()[0].ID
+	nowPlayingID := tb.discord.Messages(topicID)[0].ID
+	edits := tb.discord.MessageEdits(topicID)
+	if len(edits) != 1 || edits[0].ID != nowPlayingID {
+		t.Fatalf("edits = %+v, want the now playing message ended", edits)
+	}
+	embed := (*edits[0].Embeds)[0]
+	if embed.Title != "🎵 track t1" || len(embed.Fields) != 2 || embed.Fields[0].Value != tr(localeJa, msgTrackEnded) {
+		t.Errorf("ended now playing = %s %+v, want t1 %q", embed.Title, embed.Fields, tr(localeJa, msgTrackEnded))
+	}
+	if track, _, _, _ := tb.nowPlaying.get(); track != nil {
+		t.Errorf("now playing = %v, want none after the session", track)
+	}
+}
+
+// request runs /req as the interaction i and returns the reply: the server
+// message of a request result, or the content of any other reply.
+func (tb *testBot) request(t *testing.T, i *discordgo.InteractionCreate) string {
+	t.Helper()
+	edit := tb.requestEdit(t, i)
+	if edit.Embeds != nil {
+		return (*edit.Embeds)[0].Description
+	}
+	return *edit.Content
+}
+
+// requestEdit runs /req as the interaction i and returns the reply.
+func (tb *testBot) requestEdit(t *testing.T, i *discordgo.InteractionCreate) *discordgo.WebhookEdit {
+	t.Helper()
+	id := i.ID
+	tb.handleCommand(i)
+	response := tb.discord.Response(id)
+	if response == nil || response.Type != discordgo.InteractionResponseDeferredChannelMessageWithSource ||
+		response.Data.Flags != discordgo.MessageFlagsEphemeral {
+		t.Fatalf("%s: response = %+v, want ephemeral deferred response", id, response)
+	}
+	var reply *discordgo.WebhookEdit
+	tb.waitFor(t, "response of "+id, func() bool {
+		for _, edit := range tb.discord.Edits() {
+			if edit.InteractionID == id {
+				reply = edit.Edit
+				return true
+			}
+		}
+		return false
+	})
+	return reply
+}
+
+// trackID pads id into a well-formed Spotify track ID.
+func trackID(id string) string {
+	return id + strings.Repeat("0", 22-len(id))
+}
+
+// newRequest returns /req of the track trackID(id) by userID.
+func newRequest(id string, userID string, roles ...string) *discordgo.InteractionCreate {
+	i := newCommand(id, userID, cmdRequestName, urlOption("https://open.spotify.com/track/"+trackID(id)+"?si=share"))
+	i.Member.Roles = roles
+	return i
+}
+
+// requestResultCount returns the count of code in requestResults.
+func requestResultCount(code jukebox.RequestCode) int64 {
+	if v, ok := requestResults.Get(string(code)).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestRequestTrack(t *testing.T) {
+	tb := newTestBot(t)
+	accepted := requestResultCount(jukebox.RequestCodeAccepted)
+	restricted := requestResultCount(jukebox.RequestCodeMarketRestriction)
+
+	request := func(id string, userID string) string {
+		t.Helper()
+		return tb.request(t, newRequest(id, userID))
+	}
+
+	if got := request("r1", "u1"); got != tr(localeJa, msgRequestQueued) {
+		t.Errorf("first request = %q, want accepted", got)
+	}
+	if got := request("r2", "u1"); got != tr(localeJa, msgRequestQueued) {
+		t.Errorf("second request = %q, want accepted", got)
+	}
+
+	listeners := tb.server.Listeners()
+	if len(listeners) != 1 || listeners[0].DisplayName != "user u1" {
+		t.Fatalf("listeners = %v, want one for u1", listeners)
+	}
+	requests := tb.server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("requests = %d, want 2", len(requests))
+	}
+	for _, req := range requests {
+		if req.ListenerId != listeners[0].ListenerId {
+			t.Errorf("request from %s, want %s", req.ListenerId, listeners[0].ListenerId)
+		}
+	}
+	if got := requests[1].TrackId; got != trackID("r2") {
+		t.Errorf("requested track = %s", got)
+	}
+	if token, _ := tb.tokens.Load("u1"); token != listeners[0].ListenerId {
+		t.Errorf("cached token = %q, want %q", token, listeners[0].ListenerId)
+	}
+
+	tb.server.RequestTrackFunc = func(*v1.RequestTrackRequest) (*v1.RequestTrackResponse, error) {
+		return &v1.RequestTrackResponse{Success: false, Message: "not in this market", Code: "MARKET_RESTRICTION"}, nil
+	}
+	edit := tb.requestEdit(t, newRequest("r3", "u1"))
+	if got := (*edit.Embeds)[0]; got.Title != tr(localeJa, msgRequestRejected) || got.Description != tr(localeJa, msgRequestMarketRestriction) {
+		t.Errorf("rejected request = %q %q, want the market restriction message", got.Title, got.Description)
+	}
+	if want := "https://open.spotify.com/track/" + trackID("r3"); *edit.Content != want {
+		t.Errorf("content = %q, want the link to preview %q", *edit.Content, want)
+	}
+	if got := requestResultCount(jukebox.RequestCodeAccepted) - accepted; got != 2 {
+		t.Errorf("accepted count = %d, want 2", got)
+	}
+	if got := requestResultCount(jukebox.RequestCodeMarketRestriction) - restricted; got != 1 {
+		t.Errorf("market restriction count = %d, want 1", got)
+	}
+
+	// tracks never played in the guild are previewed once looked up
+	tb.finder = fakeTrackLister{"": {{ID: trackID("r4"), Name: "Four", Artists: []string{"X"}, AlbumArtURL: "https://i.scdn.co/image/four"}}}
+	edit = tb.requestEdit(t, newRequest("r4", "u1"))
+	if embed := (*edit.Embeds)[0]; len(embed.Fields) != 1 || embed.Fields[0].Name != "🎵 Four" || embed.Thumbnail == nil || embed.Thumbnail.URL != "https://i.scdn.co/image/four" {
+		t.Errorf("looked up track preview = %+v %+v", embed.Fields, embed.Thumbnail)
+	}
+	if edit.Content != nil && *edit.Content != "" {
+		t.Errorf("content = %q, want no link next to the preview", *edit.Content)
+	}
+
+	// a stalled lookup gives up and leaves the link to preview
+	tb.finder = stalledTrackFinder{}
+	edit = tb.requestEdit(t, newRequest("r5", "u1"))
+	if want := "https://open.spotify.com/track/" + trackID("r5"); edit.Content == nil || *edit.Content != want {
+		t.Errorf("content = %v, want the link to preview %q", edit.Content, want)
+	}
+
+	invalid := []struct {
+		url  string
+		want string
+	}{
+		{"https://open.spotify.com/playlist/" + trackID("p1"), tr(localeJa, msgNotTrackURL)},
+		{"https://example.com/track/" + trackID("x1"), tr(localeJa, msgInvalidTrackURL)},
+	}
+	for n, tt := range invalid {
+		id := fmt.Sprintf("invalid%d", n)
+		if got := tb.request(t, newCommand(id, "u1", cmdRequestName, urlOption(tt.url))); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	if got := len(tb.server.Requests()); got != 2 {
+		t.Errorf("requests = %d, want invalid URLs rejected locally", got)
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.AdminRoleID = "admin"
+		cfg.RateLimit = RateLimitConfig{
+			Burst:         2,
+			Interval:      time.Hour,
+			SessionQuota:  3,
+			ExemptRoleIDs: []string{"dj"},
+		}
+	})
+
+	// a request that fails before the server answers is not charged
+	tb.server.RequestTrackFunc = func(*v1.RequestTrackRequest) (*v1.RequestTrackResponse, error) {
+		return nil, connect.NewError(connect.CodeUnavailable, errors.New("server restarting"))
+	}
+	if got := tb.request(t, newRequest("r0", "u1")); got != tr(localeJa, msgInternalError) {
+		t.Errorf("r0 = %q, want the internal error", got)
+	}
+	tb.server.RequestTrackFunc = nil
+
+	for _, id := range []string{"r1", "r2"} {
+		if got := tb.request(t, newRequest(id, "u1")); got != tr(localeJa, msgRequestQueued) {
+			t.Errorf("%s = %q, want accepted", id, got)
+		}
+	}
+	got := tb.request(t, newRequest("r3", "u1"))
+	if !strings.HasPrefix(got, "リクエストが続いています。<t:") {
+		t.Errorf("rate limited reply = %q", got)
+	}
+	if got := len(tb.server.Requests()); got != 2 {
+		t.Errorf("requests = %d, want the third one stopped by the bot", got)
+	}
+
+	for _, id := range []string{"r4", "r5", "r6"} {
+		if got := tb.request(t, newRequest(id, "u2", "dj")); got != tr(localeJa, msgRequestQueued) {
+			t.Errorf("%s from an exempt role = %q, want accepted", id, got)
+		}
+	}
+	if got := tb.request(t, newRequest("r7", "u3", "admin")); got != tr(localeJa, msgRequestQueued) {
+		t.Errorf("request from an admin = %q, want accepted", got)
+	}
+
+	// without the rate limit, the session quota still applies
+	tb.limiter = nil
+	if got := tb.request(t, newRequest("r8", "u1")); got != tr(localeJa, msgRequestQueued) {
+		t.Errorf("r8 = %q, want accepted", got)
+	}
+	if got, want := tb.request(t, newRequest("r9", "u1")), tr(localeJa, msgSessionQuotaReached, 3); got != want {
+		t.Errorf("over quota reply = %q, want %q", got, want)
+	}
+}
+
+func TestRequestAutocomplete(t *testing.T) {
+	tb := newTestBot(t)
+	session := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, session, jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_PLAYING)),
+		jukeboxtest.ChangeTrack(2, session, jukeboxtest.Track("t2", v1.TrackState_TRACK_STATE_STARTED)),
+	)
+	tb.start(t)
+	tb.waitFor(t, "tracks", func() bool {
+		return len(tb.discord.Messages("")) == 2
+	})
+
+	autocomplete := func(id string, query string) []string {
+		t.Helper()
+		option := urlOption(query)
+		option.Focused = true
+		i := newCommand(id, "u1", cmdRequestName, option)
+		i.Type = discordgo.InteractionApplicationCommandAutocomplete
+		tb.handleCommand(i)
+		response := tb.discord.Response(id)
+		if response == nil || response.Type != discordgo.InteractionApplicationCommandAutocompleteResult {
+			t.Fatalf("%s: response = %+v, want autocomplete result", id, response)
+		}
+		var choices []string
+		for _, choice := range response.Data.Choices {
+			choices = append(choices, choice.Name+" "+choice.Value.(string))
+		}
+		return choices
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{
+			"track t2 / artist t2 https://open.spotify.com/track/t2",
+			"track t1 / artist t1 https://open.spotify.com/track/t1",
+		}},
+		{"T1", []string{"track t1 / artist t1 https://open.spotify.com/track/t1"}},
+		{"artist t2", []string{"track t2 / artist t2 https://open.spotify.com/track/t2"}},
+		{"nothing", nil},
+		{"https://open.spotify.com/track/" + trackID("x"), nil},
+	}
+	for n, tt := range tests {
+		if got := autocomplete(fmt.Sprintf("a%d", n), tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("choices for %q = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	history, _ := tb.store.LoadHistory(testGuildID)
+	if len(history) != 2 || history[0].TrackID != "t1" || history[0].Plays != 1 {
+		t.Errorf("stored history = %+v", history)
+	}
+
+	// accepted requests are suggested too, once their name is known
+	if got := tb.request(t, newRequest("r1", "u1")); got != tr(localeJa, msgRequestQueued) {
+		t.Fatalf("r1 = %q, want accepted", got)
+	}
+	tb.finder = fakeTrackLister{"": {{ID: trackID("r2"), Name: "Requested", Artists: []string{"Z"}}}}
+	if got := tb.request(t, newRequest("r2", "u1")); got != tr(localeJa, msgRequestQueued) {
+		t.Fatalf("r2 = %q, want accepted", got)
+	}
+	want := []string{"Requested / Z https://open.spotify.com/track/" + trackID("r2")}
+	if got := autocomplete("a-requested", "requested"); !slices.Equal(got, want) {
+		t.Errorf("choices for a requested track = %q, want %q", got, want)
+	}
+	if got := autocomplete("a-recent", ""); len(got) != 3 || got[0] != want[0] {
+		t.Errorf("recent choices = %q, want the requested track first", got)
+	}
+	history, _ = tb.store.LoadHistory(testGuildID)
+	if len(history) != 3 || history[2].Requests != 1 || history[2].Plays != 0 {
+		t.Errorf("stored history = %+v, want the requested track", history)
+	}
+}
+
+func TestRequestRejoins(t *testing.T) {
+	tb := newTestBot(t)
+	if got := tb.request(t, newRequest("r1", "u1")); got != tr(localeJa, msgRequestQueued) {
+		t.Fatalf("r1 = %q, want accepted", got)
+	}
+
+	// the server restarts and forgets the listener
+	tb.server.ForgetListeners()
+	if got := tb.request(t, newRequest("r2", "u1")); got != tr(localeJa, msgRequestQueued) {
+		t.Errorf("r2 = %q, want accepted after joining again", got)
+	}
+	listeners := tb.server.Listeners()
+	if len(listeners) != 1 || tb.server.Joins() != 2 {
+		t.Fatalf("listeners = %v after %d joins, want one joined again", listeners, tb.server.Joins())
+	}
+	if token, _ := tb.tokens.Load("u1"); token != listeners[0].ListenerId {
+		t.Errorf("cached token = %q, want %q", token, listeners[0].ListenerId)
+	}
+
+	// joining again is tried only once
+	tb.server.RequestTrackFunc = func(req *v1.RequestTrackRequest) (*v1.RequestTrackResponse, error) {
+		return nil, connect.NewError(connect.CodeNotFound, errors.Newf("listener %s not found", req.ListenerId))
+	}
+	if got := tb.request(t, newRequest("r3", "u1")); got != tr(localeJa, msgInternalError) {
+		t.Errorf("r3 = %q, want the internal error", got)
+	}
+	if got := tb.server.Joins(); got != 3 {
+		t.Errorf("joins = %d, want 3", got)
+	}
+
+	// a track the server cannot find is not a forgotten listener
+	tb.server.RequestTrackFunc = func(*v1.RequestTrackRequest) (*v1.RequestTrackResponse, error) {
+		return nil, connect.NewError(connect.CodeNotFound, errors.New("track not found"))
+	}
+	if got := tb.request(t, newRequest("r3b", "u1")); got != tr(localeJa, msgInternalError) {
+		t.Errorf("r3b = %q, want the internal error", got)
+	}
+	if got := tb.server.Joins(); got != 3 {
+		t.Errorf("joins = %d, want no join for a missing track", got)
+	}
+
+	// kicked users do not join again
+	tb.server.RequestTrackFunc = func(*v1.RequestTrackRequest) (*v1.RequestTrackResponse, error) {
+		return &v1.RequestTrackResponse{Success: false, Message: "bye", Code: "kicked"}, nil
+	}
+	token, _ := tb.tokens.Load("u1")
+	if got := tb.request(t, newRequest("r4", "u1")); got != tr(localeJa, msgRequestKicked) {
+		t.Errorf("r4 = %q, want kicked", got)
+	}
+	if got := tb.server.Joins(); got != 3 {
+		t.Errorf("joins = %d, want no join for a kicked user", got)
+	}
+	if got, _ := tb.tokens.Load("u1"); got != token {
+		t.Errorf("cached token = %q, want %q kept", got, token)
+	}
+}
+
+// newMessageRequest returns the context menu request on a message by userID.
+func newMessageRequest(id string, userID string, message *discordgo.Message) *discordgo.InteractionCreate {
+	i := newCommand(id, userID, cmdRequestMessageName)
+	data := i.Data.(discordgo.ApplicationCommandInteractionData)
+	data.CommandType = discordgo.MessageApplicationCommand
+	data.TargetID = message.ID
+	data.Resolved = &discordgo.ApplicationCommandInteractionDataResolved{
+		Messages: map[string]*discordgo.Message{message.ID: message},
+	}
+	i.Data = data
+	return i
+}
+
+func TestRequestMessageTrack(t *testing.T) {
+	tb := newTestBot(t)
+
+	tests := []struct {
+		name    string
+		message *discordgo.Message
+		want    string
+		wantID  string
+	}{
+		{
+			name:    "content",
+			message: &discordgo.Message{ID: "m1", Content: "これ最高 https://open.spotify.com/intl-ja/track/" + trackID("m1") + "?si=x"},
+			want:    tr(localeJa, msgRequestQueued),
+			wantID:  trackID("m1"),
+		},
+		{
+			name: "embed",
+			message: &discordgo.Message{ID: "m2", Content: "see below", Embeds: []*discordgo.MessageEmbed{
+				{URL: "https://open.spotify.com/track/" + trackID("m2")},
+			}},
+			want:   tr(localeJa, msgRequestQueued),
+			wantID: trackID("m2"),
+		},
+		{
+			name:    "album",
+			message: &discordgo.Message{ID: "m3", Content: "https://open.spotify.com/album/" + trackID("m3")},
+			want:    tr(localeJa, msgNoTrackInMessage),
+		},
+		{
+			name:    "no link",
+			message: &discordgo.Message{ID: "m4", Content: "hello"},
+			want:    tr(localeJa, msgNoTrackInMessage),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := len(tb.server.Requests())
+			if got := tb.request(t, newMessageRequest("i-"+tt.message.ID, "u1", tt.message)); got != tt.want {
+				t.Errorf("reply = %q, want %q", got, tt.want)
+			}
+			got := tb.server.Requests()
+			if tt.wantID == "" {
+				if len(got) != requests {
+					t.Errorf("requests = %v, want none sent", got[requests:])
+				}
+				return
+			}
+			if len(got) != requests+1 || got[requests].TrackId != tt.wantID {
+				t.Errorf("requests = %v, want %s", got[requests:], tt.wantID)
+			}
+		})
+	}
+}
+
+// fakeTrackLister lists the tracks of albums and playlists by their ID, and
+// looks up the tracks it lists.
+type fakeTrackLister map[string][]spotify.Track
+
+func (l fakeTrackLister) Tracks(_ context.Context, link spotify.Link, limit int) ([]spotify.Track, error) {
+	tracks, ok := l[link.ID]
+	if !ok {
+		return nil, spotify.ErrNotFound
+	}
+	return tracks[:min(len(tracks), limit)], nil
+}
+
+func (l fakeTrackLister) Track(_ context.Context, trackID string) (spotify.Track, error) {
+	for _, tracks := range l {
+		for _, track := range tracks {
+			if track.ID == trackID {
+				return track, nil
+			}
+		}
+	}
+	return spotify.Track{}, spotify.ErrNotFound
+}
+
+// stalledTrackFinder looks up no track until the lookup is canceled.
+type stalledTrackFinder struct{}
+
+func (stalledTrackFinder) Track(ctx context.Context, _ string) (spotify.Track, error) {
+	<-ctx.Done()
+	return spotify.Track{}, ctx.Err()
+}
+
+// requestMulti runs /req-multi with input and returns the reply embed.
+func (tb *testBot) requestMulti(t *testing.T, id string, input string) *discordgo.MessageEmbed {
+	t.Helper()
+	option := &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  cmdOptionURLsName,
+		Type:  discordgo.ApplicationCommandOptionString,
+		Value: input,
+	}
+	edit := tb.requestEdit(t, newCommand(id, "u1", cmdRequestMultiName, option))
+	if edit.Embeds == nil {
+		t.Fatalf("%s: reply = %q, want an embed", id, *edit.Content)
+	}
+	return (*edit.Embeds)[0]
+}
+
+func TestRequestMulti(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.MultiRequestLimit = 3
+	})
+	trackURL := func(id string) string {
+		return "https://open.spotify.com/track/" + trackID(id)
+	}
+	albumID, playlistID := trackID("album"), trackID("playlist")
+	sentSince := func(n int) []string {
+		var ids []string
+		for _, req := range tb.server.Requests()[n:] {
+			ids = append(ids, req.TrackId)
+		}
+		return ids
+	}
+
+	// without Spotify credentials only tracks can be requested
+	embed := tb.requestMulti(t, "m1", trackURL("a")+", "+trackURL("b")+" https://open.spotify.com/album/"+albumID+" hello")
+	if want := tr(localeJa, msgMultiRequestTitle, 2, 2); embed.Title != want {
+		t.Errorf("m1 title = %q, want %q", embed.Title, want)
+	}
+	for _, want := range []string{tr(localeJa, msgMultiRequestNoSpotify), tr(localeJa, msgMultiRequestNotLink), "✅ " + trackURL("b")} {
+		if !strings.Contains(embed.Description, want) {
+			t.Errorf("m1 description = %q, want %q", embed.Description, want)
+		}
+	}
+	if got := sentSince(0); !slices.Equal(got, []string{trackID("a"), trackID("b")}) {
+		t.Errorf("m1 requests = %v", got)
+	}
+
+	// albums and playlists are listed up to the limit
+	tb.tracks = fakeTrackLister{
+		playlistID: {
+			{ID: trackID("p1"), Name: "One", Artists: []string{"X"}},
+			{ID: trackID("p2"), Name: "Two"},
+			{ID: trackID("p3"), Name: "Three"},
+			{ID: trackID("p4"), Name: "Four"},
+		},
+	}
+	sent := len(tb.server.Requests())
+	embed = tb.requestMulti(t, "m2", "spotify:playlist:"+playlistID+" https://open.spotify.com/album/"+albumID)
+	if want := tr(localeJa, msgMultiRequestTitle, 3, 3); embed.Title != want {
+		t.Errorf("m2 title = %q, want %q", embed.Title, want)
+	}
+	for _, want := range []string{
+		"[One / X](" + trackURL("p1") + ")",
+		tr(localeJa, msgMultiRequestTruncated, 3),
+		tr(localeJa, msgMultiRequestNotFound),
+	} {
+		if !strings.Contains(embed.Description, want) {
+			t.Errorf("m2 description = %q, want %q", embed.Description, want)
+		}
+	}
+	if got := sentSince(sent); !slices.Equal(got, []string{trackID("p1"), trackID("p2"), trackID("p3")}) {
+		t.Errorf("m2 requests = %v", got)
+	}
+
+	// the batch stops at a rejection the rest would get too
+	var called []string
+	tb.server.RequestTrackFunc = func(req *v1.RequestTrackRequest) (*v1.RequestTrackResponse, error) {
+		called = append(called, req.TrackId)
+		switch req.TrackId {
+		case trackID("c"):
+			return &v1.RequestTrackResponse{Success: false, Message: "restricted", Code: "market_restriction"}, nil
+		case trackID("d"):
+			return &v1.RequestTrackResponse{Success: false, Message: "pending", Code: "user_pending"}, nil
+		}
+		return &v1.RequestTrackResponse{Success: true, Message: "ok"}, nil
+	}
+	embed = tb.requestMulti(t, "m3", trackURL("c")+" "+trackURL("d")+" "+trackURL("e"))
+	if want := tr(localeJa, msgMultiRequestTitle, 0, 3); embed.Title != want || embed.Color != rejectedColor {
+		t.Errorf("m3 title = %q, want %q", embed.Title, want)
+	}
+	for _, want := range []string{
+		tr(localeJa, msgRequestMarketRestriction),
+		tr(localeJa, msgRequestUserPending),
+		tr(localeJa, msgMultiRequestStopped, 1),
+	} {
+		if !strings.Contains(embed.Description, want) {
+			t.Errorf("m3 description = %q, want %q", embed.Description, want)
+		}
+	}
+	if !slices.Equal(called, []string{trackID("c"), trackID("d")}) {
+		t.Errorf("m3 requests = %v, want the last one not sent", called)
+	}
+
+	// nothing usable
+	embed = tb.requestMulti(t, "m4", "spotify:artist:"+albumID)
+	if embed.Title != tr(localeJa, msgMultiRequestNoTracks) || !strings.Contains(embed.Description, tr(localeJa, msgMultiRequestNotSupported)) {
+		t.Errorf("m4 = %q: %q", embed.Title, embed.Description)
+	}
+}
+
+// logRecorder collects the log lines written while it is installed.
+type logRecorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// recordLog routes the global logger to a logRecorder until the test ends.
+func recordLog(t *testing.T) *logRecorder {
+	t.Helper()
+	r := &logRecorder{}
+	logger := zlog.Logger
+	zlog.Logger = zerolog.New(r)
+	t.Cleanup(func() { zlog.Logger = logger })
+	return r
+}
+
+func (r *logRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.Write(p)
+}
+
+func (r *logRecorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.buf.String()
+}
+
+// newAdminCommand returns /admin subcommand by userID with roles.
+func newAdminCommand(id string, userID string, subcommand string, roles []string, options ...*discordgo.ApplicationCommandInteractionDataOption) *discordgo.InteractionCreate {
+	i := newCommand(id, userID, cmdAdminName, &discordgo.ApplicationCommandInteractionDataOption{
+		Name:    subcommand,
+		Type:    discordgo.ApplicationCommandOptionSubCommand,
+		Options: options,
+	})
+	i.Member.Roles = roles
+	return i
+}
+
+func TestAdminCommands(t *testing.T) {
+	const adminRole = "admin-role"
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.AdminRoleID = adminRole
+	})
+	logs := recordLog(t)
+
+	// u2 joins, so that there is a listener to list and kick
+	if got := tb.request(t, newRequest("r1", "u2")); got != tr(localeJa, msgRequestQueued) {
+		t.Fatalf("r1 = %q, want accepted", got)
+	}
+	userOption := &discordgo.ApplicationCommandInteractionDataOption{
+		Name:  cmdOptionUserName,
+		Type:  discordgo.ApplicationCommandOptionUser,
+		Value: "u2",
+	}
+
+	tests := []struct {
+		subcommand string
+		options    []*discordgo.ApplicationCommandInteractionDataOption
+		call       string
+		want       string
+	}{
+		{cmdAdminPauseName, nil, "Pause", "paused"},
+		{cmdAdminResumeName, nil, "Resume", "resumed"},
+		{cmdAdminSkipName, nil, "Skip", "skipped"},
+		{cmdAdminStopName, nil, "StopSession", "stopped"},
+		{cmdAdminListenersName, nil, "ListListeners", tr(localeJa, msgAdminListenerLine, "user u2", 1, "")},
+		{cmdAdminKickName, []*discordgo.ApplicationCommandInteractionDataOption{userOption}, "Kick", "kicked"},
+		{cmdAdminStatusName, nil, "GetStatus", tr(localeJa, msgNoSession)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.subcommand, func(t *testing.T) {
+			calls := len(tb.server.AdminCalls())
+			forbidden := newAdminCommand("forbidden-"+tt.subcommand, "u1", tt.subcommand, []string{"other"}, tt.options...)
+			if got := tb.request(t, forbidden); got != tr(localeJa, msgAdminForbidden) {
+				t.Errorf("without the admin role = %q, want forbidden", got)
+			}
+			if got := tb.server.AdminCalls()[calls:]; len(got) != 0 {
+				t.Errorf("admin calls without the admin role = %v, want none", got)
+			}
+			if want := fmt.Sprintf("action=admin/%s result=forbidden", tt.subcommand); !strings.Contains(logs.String(), want) {
+				t.Errorf("log = %s, want %q", logs, want)
+			}
+
+			allowed := newAdminCommand("allowed-"+tt.subcommand, "u1", tt.subcommand, []string{adminRole}, tt.options...)
+			if got := tb.request(t, allowed); got != tt.want {
+				t.Errorf("reply = %q, want %q", got, tt.want)
+			}
+			if got := tb.server.AdminCalls()[calls:]; !slices.Equal(got, []string{tt.call}) {
+				t.Errorf("admin calls = %v, want %s", got, tt.call)
+			}
+			if want := fmt.Sprintf("user=user u1(u1) action=admin/%s result=", tt.subcommand); strings.Count(logs.String(), want) != 2 {
+				t.Errorf("log = %s, want the invocations audited", logs)
+			}
+		})
+	}
+
+	if listeners := tb.server.Listeners(); !listeners[0].IsKicked {
+		t.Errorf("listeners = %v, want u2 kicked", listeners)
+	}
+
+	// a subcommand unknown to this version, e.g. one left registered by a
+	// newer one, is answered and audited
+	calls := len(tb.server.AdminCalls())
+	if got := tb.request(t, newAdminCommand("unknown", "u1", "rewind", []string{adminRole})); got != tr(localeJa, msgInternalError) {
+		t.Errorf("unknown subcommand = %q, want an internal error", got)
+	}
+	if got := tb.server.AdminCalls()[calls:]; len(got) != 0 {
+		t.Errorf("admin calls for an unknown subcommand = %v, want none", got)
+	}
+	if want := "action=admin/rewind result=unknown"; !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %s, want %q", logs, want)
+	}
+}
+
+func TestStatusCommands(t *testing.T) {
+	tb := newTestBot(t)
+
+	// no session
+	for _, name := range []string{cmdNowPlayingName, cmdStatusName} {
+		if got := tb.request(t, newCommand("none-"+name, "u1", name)); got != tr(localeJa, msgNoSession) {
+			t.Errorf("/%s without a session = %q, want no session", name, got)
+		}
+	}
+
+	// a running session without a track
+	session := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+	tb.server.SetStatus(&v1.GetStatusResponse{SessionInfo: session, QueueSize: 2, ListenerCount: 3})
+	if got := tb.request(t, newCommand("idle-nowplaying", "u1", cmdNowPlayingName)); got != tr(localeJa, msgNoTrackPlaying) {
+		t.Errorf("/nowplaying without a track = %q, want no track", got)
+	}
+
+	// a running session playing a track
+	tb.server.SetStatus(&v1.GetStatusResponse{
+		SessionInfo:   session,
+		CurrentTrack:  jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_PLAYING),
+		QueueSize:     2,
+		ListenerCount: 3,
+	})
+	fieldValues := func(embed *discordgo.MessageEmbed) string {
+		values := []string{embed.Title, embed.Description}
+		for _, field := range embed.Fields {
+			values = append(values, field.Name+"="+field.Value)
+		}
+		return strings.Join(values, "\n")
+	}
+
+	edit := tb.requestEdit(t, newCommand("nowplaying", "u1", cmdNowPlayingName))
+	if edit.Embeds == nil {
+		t.Fatalf("/nowplaying = %+v, want an embed", edit)
+	}
+	fields := fieldValues((*edit.Embeds)[0])
+	for _, want := range []string{"track t1", formatRemaining(180)} {
+		if !strings.Contains(fields, want) {
+			t.Errorf("/nowplaying fields = %s, want %q", fields, want)
+		}
+	}
+
+	edit = tb.requestEdit(t, newCommand("status", "u1", cmdStatusName))
+	if edit.Embeds == nil {
+		t.Fatalf("/status = %+v, want an embed", edit)
+	}
+	fields = fieldValues((*edit.Embeds)[0])
+	for _, want := range []string{
+		formatSessionState(localeJa, v1.SessionState_SESSION_STATE_RUNNING),
+		tr(localeJa, msgQueueSize, 2),
+		tr(localeJa, msgListenerCount, 3),
+		"track t1",
+	} {
+		if !strings.Contains(fields, want) {
+			t.Errorf("/status fields = %s, want %q", fields, want)
+		}
+	}
+}
+
+func TestResyncEnding(t *testing.T) {
+	tb := newTestBot(t)
+	running := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+	running.AcceptingRequests = true
+	ending := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_ENDING)
+	t2 := jukeboxtest.Track("t2", v1.TrackState_TRACK_STATE_STARTED)
+	// the session started ending and moved on to t2 while notifications
+	// were missed
+	tb.server.SetStatus(&v1.GetStatusResponse{SessionInfo: ending, CurrentTrack: t2})
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, running, jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_PLAYING)),
+		// a notification the client drops, so only the resync tells of t2
+		jukeboxtest.ChangeTrack(3, ending, jukeboxtest.Track("t2", v1.TrackState_TRACK_STATE_UNSPECIFIED)),
+	)
+	tb.start(t)
+
+	tb.waitFor(t, "resync", func() bool {
+		return len(tb.discord.Messages("")) == 3 && len(tb.getPlayedTracks()) == 2
+	})
+	var contents []string
+	for _, m := range tb.discord.Messages("") {
+		contents = append(contents, m.Message.Content)
+	}
+	if !slices.Contains(contents, tr(localeJa, msgSessionEndingLine)) {
+		t.Errorf("messages = %q, want the ending line", contents)
+	}
+	if got := v1.SessionState(tb.sessionState.Load()); got != v1.SessionState_SESSION_STATE_ENDING {
+		t.Errorf("session state = %v, want ending", got)
+	}
+	if tb.isAccepting() {
+		t.Error("requests still accepted after the session started ending")
+	}
+	if played := tb.getPlayedTracks(); played[1].TrackID != "t2" {
+		t.Errorf("played tracks = %+v, want t2 recorded", played)
+	}
+	if _, ok := tb.guilds[0].history.find("t2"); !ok {
+		t.Error("t2 not recorded in the history")
+	}
+}
+
+func TestRestoreSession(t *testing.T) {
+	tb := newTestBot(t)
+	// the state saved before a restart, in the middle of s1
+	if err := tb.store.Save(&store.SessionState{
+		SessionID:    "s1",
+		Started:      true,
+		TopicIDs:     map[string]string{testGuildID: "thread-old"},
+		Tokens:       map[string]string{"u1": "listener-old"},
+		PostedTracks: []string{"t1"},
+		PlayedTracks: []store.PlayedTrack{{TrackID: "t1", Name: "track t1"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s1 := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+	s2 := jukeboxtest.Session("s2", v1.SessionState_SESSION_STATE_RUNNING)
+	tb.server.Notify(
+		jukeboxtest.InitialState(1, s1, jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_PLAYING)),
+		jukeboxtest.ChangeTrack(2, s1, jukeboxtest.Track("t2", v1.TrackState_TRACK_STATE_STARTED)),
+	)
+	tb.start(t)
+
+	tb.waitFor(t, "t2 posted", func() bool {
+		return len(tb.discord.Messages("thread-old")) == 1
+	})
+	if threads := tb.discord.Threads(); len(threads) != 0 {
+		t.Errorf("threads = %v, want the restored topic reused", threads)
+	}
+	if got := tb.discord.Messages("thread-old")[0].Message.Embed.Title; got != "🎵 track t2" {
+		t.Errorf("posted %q, want only t2 as t1 was posted before the restart", got)
+	}
+	if token, _ := tb.tokens.Load("u1"); token != "listener-old" {
+		t.Errorf("token of u1 = %q, want the restored one", token)
+	}
+	if got := len(tb.getPlayedTracks()); got != 2 {
+		t.Errorf("played tracks = %d, want the restored one and t2", got)
+	}
+
+	// switching to s2 forgets s1
+	tb.server.Notify(jukeboxtest.ChangeState(3, s2, nil))
+	tb.waitFor(t, "s2 topic", func() bool {
+		return len(tb.discord.Threads()) == 1
+	})
+	if state, _ := tb.store.Load("s1"); state != nil {
+		t.Errorf("state of s1 = %+v, want deleted", state)
+	}
+	if _, ok := tb.tokens.Load("u1"); ok {
+		t.Error("token of u1 kept, want the tokens of s1 forgotten")
+	}
+}
+
+func TestRegisterCommandsPerGuild(t *testing.T) {
+	tb := newTestBot(t, func(cfg *DiscordBotConfig) {
+		cfg.Guilds = []GuildConfig{{GuildID: "guild2", ForumID: "forum2"}}
+	})
+	tb.setAppID(testAppID)
+	tb.discord.FailGuild(testGuildID, "ApplicationCommandCreate", errors.New("missing access"))
+
+	err := tb.registerCommand()
+	if err == nil || !strings.Contains(err.Error(), "guild["+testGuildID+"]") {
+		t.Errorf("registerCommand() = %v, want the error of %s", err, testGuildID)
+	}
+	if got := len(tb.discord.Commands(testGuildID)); got != 0 {
+		t.Errorf("commands in %s = %d, want 0", testGuildID, got)
+	}
+	if got := len(tb.discord.Commands("guild2")); got != 5 {
+		t.Errorf("commands in guild2 = %d, want 5 despite the failing guild", got)
+	}
+}
@@ -2,68 +2,148 @@ package bot
 
 import (
 	"context"
+	"expvar"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	"github.com/osa030/19box-discordbot/internal/spotify"
 	zlog "github.com/rs/zerolog/log"
 )
 
+// requestResults counts the results of /req by RequestCode, published with
+// expvar.
+var requestResults = expvar.NewMap("request_results")
+
+// requestResultError counts the requests that failed to reach the server.
+const requestResultError = "error"
+
 const (
-	cmdRequestName        = "req"
-	cmdRequestDescription = "楽曲リクエスト受付コマンド"
-	cmdOptionURLName      = "url"
-	cmdOptionURLDesc      = "Spotifyの楽曲URLを入力してください"
+	cmdRequestName    = "req"
+	cmdOptionURLName  = "url"
+	cmdNowPlayingName = "nowplaying"
+	cmdStatusName     = "status"
+	// cmdRequestMessageName is the message context menu command requesting
+	// the track linked in a message.
+	cmdRequestMessageName = "19boxにリクエスト"
 )
 
 // Registration and Unregistration
 
+// registerCommand registers the commands in every guild. A guild that fails
+// does not keep the others from getting theirs.
 func (b *Bot) registerCommand() error {
-	cmd := &discordgo.ApplicationCommand{
-		Name:        cmdRequestName,
-		Description: cmdRequestDescription,
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        cmdOptionURLName,
-				Description: cmdOptionURLDesc,
-				Required:    true,
+	var errs []error
+	for _, g := range b.guilds {
+		if err := b.registerGuildCommands(g); err != nil {
+			errs = append(errs, errors.Wrapf(err, "guild[%s]", g.config.GuildID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Bot) registerGuildCommands(g *guild) error {
+	commands := []*discordgo.ApplicationCommand{
+		{
+			Name:                     cmdRequestName,
+			Description:              tr(g.locale, cmdRequestDescription),
+			DescriptionLocalizations: localizations(cmdRequestDescription),
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:                     discordgo.ApplicationCommandOptionString,
+					Name:                     cmdOptionURLName,
+					Description:              tr(g.locale, cmdOptionURLDesc),
+					DescriptionLocalizations: *localizations(cmdOptionURLDesc),
+					Required:                 true,
+					Autocomplete:             true,
+				},
 			},
 		},
+		requestMultiCommand(g.locale),
+		{
+			Type:              discordgo.MessageApplicationCommand,
+			Name:              cmdRequestMessageName,
+			NameLocalizations: localizations(cmdRequestMessageLabel),
+		},
+		{
+			Name:                     cmdNowPlayingName,
+			Description:              tr(g.locale, cmdNowPlayingDescription),
+			DescriptionLocalizations: localizations(cmdNowPlayingDescription),
+		},
+		{
+			Name:                     cmdStatusName,
+			Description:              tr(g.locale, cmdStatusDescription),
+			DescriptionLocalizations: localizations(cmdStatusDescription),
+		},
 	}
-	zlog.Info().Msgf("Registering command: %s", cmd.Name)
-	_, err := b.session.ApplicationCommandCreate(b.session.State.User.ID, b.config.GuildID, cmd)
-	if err != nil {
-		return err
+	if len(g.config.AdminRoleIDs) > 0 {
+		commands = append(commands, adminCommand(g.locale))
+	}
+
+	for _, cmd := range commands {
+		zlog.Info().Msgf("Registering command: %s in guild[%s]", cmd.Name, g.config.GuildID)
+		_, err := b.session.ApplicationCommandCreate(b.getAppID(), g.config.GuildID, cmd)
+		if err != nil {
+			return err
+		}
+		zlog.Info().Msgf("Command registered: %s", cmd.Name)
 	}
-	zlog.Info().Msgf("Command registered: %s", cmd.Name)
 	return nil
 }
 
 func (b *Bot) unregisterCommands() error {
-	commands, err := b.session.ApplicationCommands(b.session.State.User.ID, b.config.GuildID)
-	if err != nil {
-		return err
-	}
-	for _, cmd := range commands {
-		err := b.session.ApplicationCommandDelete(b.session.State.User.ID, b.config.GuildID, cmd.ID)
+	var errs []error
+	for _, g := range b.guilds {
+		commands, err := b.session.ApplicationCommands(b.getAppID(), g.config.GuildID)
 		if err != nil {
-			zlog.Error().Msgf("Command unregistration failed: %s", cmd.Name)
-		} else {
-			zlog.Info().Msgf("Command unregistered: %s", cmd.Name)
+			errs = append(errs, err)
+			continue
+		}
+		for _, cmd := range commands {
+			err := b.session.ApplicationCommandDelete(b.getAppID(), g.config.GuildID, cmd.ID)
+			if err != nil {
+				zlog.Error().Msgf("Command unregistration failed: %s in guild[%s]", cmd.Name, g.config.GuildID)
+			} else {
+				zlog.Info().Msgf("Command unregistered: %s in guild[%s]", cmd.Name, g.config.GuildID)
+			}
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // Handlers
 
-func (b *Bot) handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	if i.ApplicationCommandData().Name != cmdRequestName {
+func (b *Bot) handleCommand(i *discordgo.InteractionCreate) {
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		b.handleAutocomplete(i)
+		return
+	}
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	var handler func(i *discordgo.InteractionCreate)
+	switch i.ApplicationCommandData().Name {
+	case cmdRequestName:
+		handler = b.requestTrack
+	case cmdRequestMultiName:
+		handler = b.requestTracks
+	case cmdRequestMessageName:
+		handler = b.requestMessageTrack
+	case cmdNowPlayingName:
+		handler = b.handleNowPlaying
+	case cmdStatusName:
+		handler = b.handleStatus
+	case cmdAdminName:
+		handler = b.handleAdmin
+	default:
 		return
 	}
 
 	// response to user that the bot is thinking (too slow to respond)
-	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Flags: discordgo.MessageFlagsEphemeral,
@@ -74,67 +154,229 @@ func (b *Bot) handleCommand(s *discordgo.Session, i *discordgo.InteractionCreate
 		return
 	}
 
-	go b.requestTrack(i)
+	go handler(i)
 }
 
-func (b *Bot) requestTrack(i *discordgo.InteractionCreate) {
-	// get user information
-	var userID string
-	var displayName string
+// interactionUser returns the ID and display name of the user who invoked i.
+func interactionUser(i *discordgo.InteractionCreate) (string, string) {
 	if i.User != nil {
-		userID = i.User.ID
-		displayName = i.User.DisplayName()
-	} else if i.Member != nil && i.Member.User != nil {
-		userID = i.Member.User.ID
-		displayName = i.Member.User.DisplayName()
+		return i.User.ID, i.User.DisplayName()
 	}
-	if userID == "" {
-		zlog.Error().Msg("User ID not found")
-		b.responseUpdate(i, msgInternalError)
-		return
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User.ID, i.Member.User.DisplayName()
 	}
-	zlog.Info().Msgf("Command from user: ID=%s, Name=%s", userID, displayName)
+	return "", ""
+}
 
+func (b *Bot) requestTrack(i *discordgo.InteractionCreate) {
 	// get request track URL
 	options := i.ApplicationCommandData().Options
 	if len(options) == 0 {
 		zlog.Error().Msg("No options provided")
-		b.responseUpdate(i, msgInternalError)
+		b.responseUpdate(i, tr(b.locale(i), msgInternalError))
+		return
+	}
+	b.requestTrackURL(i, options[0].StringValue())
+}
+
+// requestMessageTrack requests the first Spotify track linked in the message
+// the context menu command was used on.
+func (b *Bot) requestMessageTrack(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	var message *discordgo.Message
+	if data.Resolved != nil {
+		message = data.Resolved.Messages[data.TargetID]
+	}
+	if message == nil {
+		zlog.Error().Msgf("Target message[%s] not resolved", data.TargetID)
+		b.responseUpdate(i, tr(b.locale(i), msgInternalError))
+		return
+	}
+	trackID, ok := findMessageTrack(message)
+	if !ok {
+		zlog.Info().Msgf("No track link in message[%s]", message.ID)
+		b.responseUpdate(i, tr(b.locale(i), msgNoTrackInMessage))
+		return
+	}
+	b.requestTrackURL(i, spotify.Link{Kind: spotify.KindTrack, ID: trackID}.URL())
+}
+
+// findMessageTrack returns the ID of the first track linked in the content or
+// the embeds of message.
+func findMessageTrack(message *discordgo.Message) (string, bool) {
+	if trackID, ok := spotify.FindTrack(message.Content); ok {
+		return trackID, true
+	}
+	for _, embed := range message.Embeds {
+		if trackID, ok := spotify.FindTrack(embed.URL); ok {
+			return trackID, true
+		}
+	}
+	return "", false
+}
+
+// requestTrackURL requests trackURL for the user who invoked i and replies
+// with the result.
+func (b *Bot) requestTrackURL(i *discordgo.InteractionCreate, trackURL string) {
+	// get user information
+	userID, displayName := interactionUser(i)
+	if userID == "" {
+		zlog.Error().Msg("User ID not found")
+		b.responseUpdate(i, tr(b.locale(i), msgInternalError))
 		return
 	}
-	trackURL := options[0].StringValue()
+	zlog.Info().Msgf("Command from user: ID=%s, Name=%s", userID, displayName)
 	zlog.Info().Msgf("Request trackURL=[%s] from user: ID=%s", trackURL, userID)
 
-	// find token
-	var token string
-	token, ok := b.tokens.Load(userID)
+	trackID, err := spotify.ParseTrack(trackURL)
+	if err != nil {
+		zlog.Info().Msgf("Invalid track URL [%s]: %v", trackURL, err)
+		if errors.Is(err, spotify.ErrNotTrack) {
+			b.responseUpdate(i, tr(b.locale(i), msgNotTrackURL))
+		} else {
+			b.responseUpdate(i, tr(b.locale(i), msgInvalidTrackURL))
+		}
+		return
+	}
 
-	if !ok {
-		zlog.Info().Msgf("Token not found for user: %s, generating new token", userID)
-		// generate token
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+	if !b.isAccepting() {
+		zlog.Info().Msgf("Requests are closed, rejecting request from user: %s", userID)
+		b.responseUpdate(i, tr(b.locale(i), msgRequestsClosed))
+		return
+	}
 
-		listenerId, err := b.client.Join(ctx, displayName, userID)
-		if err != nil {
-			zlog.Error().Msgf("Error 19box join: %v", err)
-			b.responseUpdate(i, msgInternalError)
-			return
+	if ok, reply := b.checkRequestLimits(i, userID); !ok {
+		b.responseUpdate(i, reply)
+		return
+	}
+
+	// look the track up while it is requested, so a slow lookup delays the
+	// reply by no more than lookupTrackTimeout
+	lookup := make(chan batchTrack, 1)
+	go func() { lookup <- b.lookupTrack(i, trackID) }()
+
+	result, err := b.requestFor(userID, displayName, trackID)
+	if err != nil {
+		b.refundRequest(i, userID)
+		b.responseUpdate(i, tr(b.locale(i), msgInternalError))
+		return
+	}
+	track := <-lookup
+	if result.Success {
+		b.recordRequest(i, track)
+	}
+	b.responseUpdateMessage(i, createRequestResultMessage(b.locale(i), result, track))
+}
+
+// requestFor requests trackID as the listener of userID, joining the server
+// when needed, and counts the result.
+func (b *Bot) requestFor(userID string, displayName string, trackID string) (jukebox.RequestResult, error) {
+	token, err := b.listenerToken(userID, displayName)
+	if err != nil {
+		zlog.Error().Msgf("Error 19box join: %v", err)
+		return jukebox.RequestResult{}, err
+	}
+
+	result, err := b.requestAs(token, trackID)
+	if jukebox.IsListenerRejected(err, token) {
+		// the server has forgotten the listener, e.g. after a restart, so
+		// join again once
+		zlog.Warn().Msgf("Listener[%s] of user %s rejected, joining again", token, userID)
+		b.tokens.Delete(userID)
+		b.saveState()
+		if token, err = b.listenerToken(userID, displayName); err == nil {
+			result, err = b.requestAs(token, trackID)
 		}
+	}
+	if err != nil {
+		zlog.Error().Msgf("Error 19box request track: %v", err)
+		requestResults.Add(requestResultError, 1)
+		return jukebox.RequestResult{}, err
+	}
 
-		token = listenerId
-		b.tokens.Store(userID, token)
+	zlog.Info().Msgf("Request track response: success=%v, message=%s, code=%s(%s)", result.Success, result.Message, result.Code, result.RawCode)
+	requestResults.Add(string(result.Code), 1)
+	if result.Success {
+		b.countRequest(userID)
 	}
+	return result, nil
+}
 
+// listenerToken returns the listener ID of userID, joining the server when
+// the user has none yet.
+func (b *Bot) listenerToken(userID string, displayName string) (string, error) {
+	if token, ok := b.tokens.Load(userID); ok {
+		return token, nil
+	}
+	zlog.Info().Msgf("Token not found for user: %s, generating new token", userID)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	success, responseMessage, responseCode, err := b.client.Request(ctx, token, trackURL)
+
+	listenerId, err := b.client.Join(ctx, displayName, userID)
 	if err != nil {
-		zlog.Error().Msgf("Error 19box request track: %v", err)
-		b.responseUpdate(i, msgInternalError)
+		return "", err
+	}
+	b.tokens.Store(userID, listenerId)
+	b.saveState()
+	return listenerId, nil
+}
+
+// requestAs requests trackID as the listener token.
+func (b *Bot) requestAs(token string, trackID string) (jukebox.RequestResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return b.client.Request(ctx, token, trackID)
+}
+
+func (b *Bot) handleNowPlaying(i *discordgo.InteractionCreate) {
+	status := b.activeStatus(i)
+	if status == nil {
 		return
 	}
+	if status.GetCurrentTrack() == nil {
+		b.responseUpdate(i, tr(b.locale(i), msgNoTrackPlaying))
+		return
+	}
+	b.responseUpdateMessage(i, createNowPlayingStatusMessage(b.locale(i), status))
+}
 
-	zlog.Info().Msgf("Request track response: success=%v, message=%s, code=%s", success, responseMessage, responseCode)
-	b.responseUpdate(i, responseMessage)
+func (b *Bot) handleStatus(i *discordgo.InteractionCreate) {
+	status := b.activeStatus(i)
+	if status == nil {
+		return
+	}
+	var iconURL string
+	if g := b.guild(i.GuildID); g != nil {
+		iconURL = g.getIconURL()
+	}
+	b.responseUpdateMessage(i, createStatusMessage(b.locale(i), status, iconURL))
+}
+
+// activeStatus returns the status of the server for /nowplaying, /status and
+// /admin status. When it cannot be got or no session is active, it replies to
+// i and returns nil.
+func (b *Bot) activeStatus(i *discordgo.InteractionCreate) *v1.GetStatusResponse {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	status, err := b.client.GetStatus(ctx)
+	if err != nil {
+		zlog.Error().Msgf("Error 19box get status: %v", err)
+		b.responseUpdate(i, tr(b.locale(i), msgInternalError))
+		return nil
+	}
+	if !isSessionActive(status.GetSessionInfo()) {
+		b.responseUpdate(i, tr(b.locale(i), msgNoSession))
+		return nil
+	}
+	return status
+}
+
+// isSessionActive reports whether sessionInfo describes a session that has
+// not ended yet.
+func isSessionActive(sessionInfo *v1.SessionInfo) bool {
+	switch sessionInfo.GetState() {
+	case v1.SessionState_SESSION_STATE_UNSPECIFIED, v1.SessionState_SESSION_STATE_TERMINATED:
+		return false
+	}
+	return true
 }
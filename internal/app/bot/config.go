@@ -1,16 +1,120 @@
 package bot
 
 import (
+	"os"
+	"time"
+
 	"github.com/cockroachdb/errors"
 	"github.com/go-playground/validator/v10"
+	"gopkg.in/yaml.v3"
 )
 
 var validate = validator.New()
 
 type DiscordBotConfig struct {
 	Token   string `yaml:"token" validate:"required"`
-	ForumID string `yaml:"forum_id" validate:"required"`
+	ForumID string `yaml:"forum_id" validate:"required_with=GuildID"`
+	GuildID string `yaml:"guild_id" validate:"required_without=Guilds"`
+	// AdminRoleID is the role allowed to use /admin in GuildID.
+	AdminRoleID string `yaml:"admin_role_id"`
+	// Locale is the default message locale (ja or en). Defaults to ja.
+	Locale string `yaml:"locale" validate:"omitempty,oneof=ja en"`
+	// Guilds lists additional guilds sharing the jukebox.
+	Guilds []GuildConfig `yaml:"guilds" validate:"dive"`
+	// Templates customizes the messages posted to the topics.
+	Templates TemplatesConfig `yaml:"templates"`
+	// LiveNowPlaying keeps a single pinned now playing message in the topic
+	// and edits it as the track changes, instead of posting every track.
+	LiveNowPlaying bool `yaml:"live_now_playing"`
+	// Reminders are how long before a scheduled session start reminders are
+	// posted to its topic. Defaults to 30 and 5 minutes; an empty list
+	// disables them.
+	Reminders []time.Duration `yaml:"reminders" validate:"dive,min=1m"`
+	// ScheduledEvents mirrors each session as a Discord scheduled event in
+	// every guild.
+	ScheduledEvents bool `yaml:"scheduled_events"`
+	// RateLimit limits how often each user can use /req.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// MultiRequestLimit is how many tracks /req-multi requests at most.
+	// Defaults to 10.
+	MultiRequestLimit int `yaml:"multi_request_limit" validate:"min=0,max=25"`
+	// Spotify holds the Web API credentials /req-multi lists the tracks of
+	// album and playlist links with. Those links are rejected without them.
+	Spotify SpotifyConfig `yaml:"spotify"`
+}
+
+// GuildConfig is the configuration of a single Discord guild.
+type GuildConfig struct {
 	GuildID string `yaml:"guild_id" validate:"required"`
+	ForumID string `yaml:"forum_id" validate:"required"`
+	// AdminRoleIDs are the roles allowed to use /admin. /admin is not registered when empty.
+	AdminRoleIDs []string `yaml:"admin_role_ids"`
+	// Locale is the locale of the messages posted to the guild. Defaults to
+	// DiscordBotConfig.Locale.
+	Locale string `yaml:"locale" validate:"omitempty,oneof=ja en"`
+}
+
+// RateLimitConfig limits the requests of each Discord user before they reach
+// the server. Zero values disable the limits.
+type RateLimitConfig struct {
+	// Burst is how many requests a user can make in a row.
+	Burst int `yaml:"burst" validate:"min=0"`
+	// Interval is how long it takes a user to regain one request.
+	Interval time.Duration `yaml:"interval" validate:"required_with=Burst,omitempty,min=1s"`
+	// SessionQuota is how many requests a user can have accepted per session.
+	SessionQuota int `yaml:"session_quota" validate:"min=0"`
+	// ExemptRoleIDs are roles not subject to the limits, in addition to the
+	// admin roles.
+	ExemptRoleIDs []string `yaml:"exempt_role_ids"`
+}
+
+// SpotifyConfig holds the credentials of a Spotify app, used with the client
+// credentials flow.
+type SpotifyConfig struct {
+	ClientID     string `yaml:"client_id" validate:"required_with=ClientSecret"`
+	ClientSecret string `yaml:"client_secret" validate:"required_with=ClientID"`
+}
+
+// TemplatesConfig holds the message templates. Messages without a template
+// keep their built-in text.
+type TemplatesConfig struct {
+	NowPlaying   *MessageTemplate `yaml:"now_playing"`
+	SessionStart *MessageTemplate `yaml:"session_start"`
+	SessionEnd   *MessageTemplate `yaml:"session_end"`
+}
+
+// MessageTemplate holds text/template sources for the parts of a message.
+// Empty parts keep their built-in text; Fields replaces all embed fields.
+type MessageTemplate struct {
+	Content     string          `yaml:"content"`
+	Title       string          `yaml:"title"`
+	Description string          `yaml:"description"`
+	Fields      []FieldTemplate `yaml:"fields"`
+}
+
+// FieldTemplate holds text/template sources for an embed field.
+type FieldTemplate struct {
+	Name   string `yaml:"name" validate:"required"`
+	Value  string `yaml:"value" validate:"required"`
+	Inline bool   `yaml:"inline"`
+}
+
+// LoadConfig reads the configuration from the YAML file at path.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func LoadConfig(path string) (*DiscordBotConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening config file")
+	}
+	defer func() { _ = f.Close() }()
+
+	var cfg DiscordBotConfig
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, errors.Wrapf(err, "error parsing config file %s", path)
+	}
+	return &cfg, nil
 }
 
 // Validate validates the configuration.
@@ -19,5 +123,53 @@ func (c *DiscordBotConfig) Validate() error {
 		return errors.Wrap(err, "struct validation failed")
 	}
 
+	seen := map[string]bool{}
+	for _, guild := range c.GuildConfigs() {
+		if seen[guild.GuildID] {
+			return errors.Newf("guild %s is configured more than once", guild.GuildID)
+		}
+		seen[guild.GuildID] = true
+	}
+
 	return nil
 }
+
+// defaultReminders are the reminder offsets used when none are configured.
+var defaultReminders = []time.Duration{30 * time.Minute, 5 * time.Minute}
+
+// reminderOffsets returns the configured reminder offsets.
+func (c *DiscordBotConfig) reminderOffsets() []time.Duration {
+	if c.Reminders == nil {
+		return defaultReminders
+	}
+	return c.Reminders
+}
+
+// defaultMultiRequestLimit is the MultiRequestLimit used when none is
+// configured.
+const defaultMultiRequestLimit = 10
+
+// multiRequestLimit returns the configured MultiRequestLimit.
+func (c *DiscordBotConfig) multiRequestLimit() int {
+	if c.MultiRequestLimit == 0 {
+		return defaultMultiRequestLimit
+	}
+	return c.MultiRequestLimit
+}
+
+// GuildConfigs returns every configured guild. GuildID, ForumID and
+// AdminRoleID make up the first one when set.
+func (c *DiscordBotConfig) GuildConfigs() []GuildConfig {
+	var guilds []GuildConfig
+	if c.GuildID != "" {
+		guild := GuildConfig{
+			GuildID: c.GuildID,
+			ForumID: c.ForumID,
+		}
+		if c.AdminRoleID != "" {
+			guild.AdminRoleIDs = []string{c.AdminRoleID}
+		}
+		guilds = append(guilds, guild)
+	}
+	return append(guilds, c.Guilds...)
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `
+token: token
+guild_id: g1
+forum_id: f1
+admin_role_id: admin
+locale: en
+live_now_playing: true
+reminders: [15m, 1m]
+rate_limit:
+  burst: 3
+  interval: 5m
+  exempt_role_ids: [dj]
+guilds:
+  - guild_id: g2
+    forum_id: f2
+    locale: ja
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.Token != "token" || cfg.Locale != localeEn || !cfg.LiveNowPlaying {
+		t.Errorf("config = %+v", cfg)
+	}
+	if !slices.Equal(cfg.Reminders, []time.Duration{15 * time.Minute, time.Minute}) {
+		t.Errorf("reminders = %v", cfg.Reminders)
+	}
+	if cfg.RateLimit.Burst != 3 || cfg.RateLimit.Interval != 5*time.Minute || !slices.Equal(cfg.RateLimit.ExemptRoleIDs, []string{"dj"}) {
+		t.Errorf("rate limit = %+v", cfg.RateLimit)
+	}
+	guilds := cfg.GuildConfigs()
+	if len(guilds) != 2 || guilds[0].GuildID != "g1" || !slices.Equal(guilds[0].AdminRoleIDs, []string{"admin"}) || guilds[1].Locale != localeJa {
+		t.Errorf("guilds = %+v", guilds)
+	}
+
+	// the example config stays loadable
+	if _, err := LoadConfig(filepath.Join("..", "..", "..", "config.example.yaml")); err != nil {
+		t.Errorf("LoadConfig(config.example.yaml): %v", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadConfig(missing file) = nil error")
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown key", "token: t\nguild_id: g\nforum_id: f\nlive_nowplaying: true\n", "field live_nowplaying not found"},
+		{"unknown nested key", "token: t\nguild_id: g\nforum_id: f\nrate_limit:\n  bursts: 3\n", "field bursts not found"},
+		{"malformed", "token: [t\n", "error parsing config file"},
+		{"bad duration", "token: t\nguild_id: g\nforum_id: f\nreminders: [soon]\n", "error parsing config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := func() *DiscordBotConfig {
+		return &DiscordBotConfig{Token: "t", GuildID: "g", ForumID: "f"}
+	}
+	tests := []struct {
+		name   string
+		modify func(cfg *DiscordBotConfig)
+		want   string
+	}{
+		{"valid", func(*DiscordBotConfig) {}, ""},
+		{"no token", func(cfg *DiscordBotConfig) { cfg.Token = "" }, "Token"},
+		{"no guild", func(cfg *DiscordBotConfig) { cfg.GuildID, cfg.ForumID = "", "" }, "GuildID"},
+		{"no forum", func(cfg *DiscordBotConfig) { cfg.ForumID = "" }, "ForumID"},
+		{"locale", func(cfg *DiscordBotConfig) { cfg.Locale = "fr" }, "Locale"},
+		{"short reminder", func(cfg *DiscordBotConfig) { cfg.Reminders = []time.Duration{30 * time.Second} }, "Reminders[0]"},
+		{"burst without interval", func(cfg *DiscordBotConfig) { cfg.RateLimit.Burst = 3 }, "Interval"},
+		{"multi request limit", func(cfg *DiscordBotConfig) { cfg.MultiRequestLimit = 26 }, "MultiRequestLimit"},
+		{"spotify without secret", func(cfg *DiscordBotConfig) { cfg.Spotify.ClientID = "id" }, "ClientSecret"},
+		{"guild without forum", func(cfg *DiscordBotConfig) { cfg.Guilds = []GuildConfig{{GuildID: "g2"}} }, "Guilds[0].ForumID"},
+		{"duplicate guild", func(cfg *DiscordBotConfig) { cfg.Guilds = []GuildConfig{{GuildID: "g", ForumID: "f2"}} }, "configured more than once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,449 @@
+// Package discordtest provides an in-memory stand-in for the Discord API
+// used by the bot, for tests.
+package discordtest
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+)
+
+// Thread is a forum thread started by the bot.
+type Thread struct {
+	ID      string
+	ForumID string
+	Name    string
+	Message *discordgo.MessageSend
+}
+
+// Message is a message sent by the bot to a channel.
+type Message struct {
+	ID        string
+	ChannelID string
+	Message   *discordgo.MessageSend
+}
+
+// Edit is an edit of an interaction response.
+type Edit struct {
+	InteractionID string
+	Edit          *discordgo.WebhookEdit
+}
+
+// Recorder records the Discord API calls of the bot in memory and answers
+// them as Discord would. It is safe for concurrent use.
+type Recorder struct {
+	mu        sync.Mutex
+	guilds    map[string]*discordgo.Guild
+	errs      map[string]error
+	nextID    int
+	status    []discordgo.UpdateStatusData
+	commands  map[string][]*discordgo.ApplicationCommand
+	responses map[string]*discordgo.InteractionResponse
+	edits     []Edit
+	threads   []Thread
+	messages  []Message
+	msgEdits  []*discordgo.MessageEdit
+	pins      map[string][]string
+	events    []*discordgo.GuildScheduledEvent
+	changed   chan struct{}
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		guilds:    map[string]*discordgo.Guild{},
+		errs:      map[string]error{},
+		commands:  map[string][]*discordgo.ApplicationCommand{},
+		responses: map[string]*discordgo.InteractionResponse{},
+		pins:      map[string][]string{},
+		changed:   make(chan struct{}),
+	}
+}
+
+// AddGuild makes guild known to Guild. Unknown guilds are answered with an
+// empty guild of the requested ID.
+func (r *Recorder) AddGuild(guild *discordgo.Guild) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.guilds[guild.ID] = guild
+}
+
+// Fail makes every later call of method (e.g. "ChannelMessageSendComplex")
+// return err. A nil err clears the failure.
+func (r *Recorder) Fail(method string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		delete(r.errs, method)
+		return
+	}
+	r.errs[method] = err
+}
+
+// FailGuild makes every later call of method in guildID return err, for the
+// methods taking a guild ID. A nil err clears the failure.
+func (r *Recorder) FailGuild(guildID string, method string, err error) {
+	r.Fail(method+"@"+guildID, err)
+}
+
+// Changed returns a channel that is closed on the next recorded call.
+func (r *Recorder) Changed() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.changed
+}
+
+// record runs fn under the lock unless method is set to fail, and wakes up
+// the waiters of Changed.
+func (r *Recorder) record(method string, fn func()) error {
+	return r.recordIn("", method, fn)
+}
+
+// recordIn is record for a call in guildID, which also fails as set by
+// FailGuild.
+func (r *Recorder) recordIn(guildID string, method string, fn func()) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.errs[method]; err != nil {
+		return err
+	}
+	if err := r.errs[method+"@"+guildID]; guildID != "" && err != nil {
+		return err
+	}
+	fn()
+	close(r.changed)
+	r.changed = make(chan struct{})
+	return nil
+}
+
+func (r *Recorder) newID(prefix string) string {
+	r.nextID++
+	return fmt.Sprintf("%s-%d", prefix, r.nextID)
+}
+
+// Status returns the presence updates sent by the bot.
+func (r *Recorder) Status() []discordgo.UpdateStatusData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.status)
+}
+
+// Commands returns the application commands registered in guildID.
+func (r *Recorder) Commands(guildID string) []*discordgo.ApplicationCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.commands[guildID])
+}
+
+// Response returns the initial response to the interaction interactionID.
+func (r *Recorder) Response(interactionID string) *discordgo.InteractionResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.responses[interactionID]
+}
+
+// Edits returns the edits of interaction responses in the order they were
+// made.
+func (r *Recorder) Edits() []Edit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.edits)
+}
+
+// Threads returns the forum threads started by the bot.
+func (r *Recorder) Threads() []Thread {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.threads)
+}
+
+// Messages returns the messages sent to channelID, or to every channel when
+// channelID is empty. Messages that started a thread are not included.
+func (r *Recorder) Messages(channelID string) []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var messages []Message
+	for _, m := range r.messages {
+		if channelID == "" || m.ChannelID == channelID {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// MessageEdits returns the edits of the messages in channelID in the order
+// they were made.
+func (r *Recorder) MessageEdits(channelID string) []*discordgo.MessageEdit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var edits []*discordgo.MessageEdit
+	for _, edit := range r.msgEdits {
+		if edit.Channel == channelID {
+			edits = append(edits, edit)
+		}
+	}
+	return edits
+}
+
+// Pins returns the IDs of the messages pinned in channelID.
+func (r *Recorder) Pins(channelID string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.pins[channelID])
+}
+
+// DeleteMessage forgets messageID as if it had been deleted in Discord, so
+// later edits of it fail.
+func (r *Recorder) DeleteMessage(messageID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = slices.DeleteFunc(r.messages, func(m Message) bool {
+		return m.ID == messageID
+	})
+}
+
+// Events returns the scheduled events of guildID as they are after every
+// edit.
+func (r *Recorder) Events(guildID string) []discordgo.GuildScheduledEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events []discordgo.GuildScheduledEvent
+	for _, event := range r.events {
+		if event.GuildID == guildID {
+			events = append(events, *event)
+		}
+	}
+	return events
+}
+
+func (r *Recorder) message(channelID, messageID string) bool {
+	return slices.ContainsFunc(r.messages, func(m Message) bool {
+		return m.ChannelID == channelID && m.ID == messageID
+	})
+}
+
+// Discord API
+
+func (r *Recorder) Open() error {
+	return r.record("Open", func() {})
+}
+
+func (r *Recorder) Close() error {
+	return r.record("Close", func() {})
+}
+
+func (r *Recorder) UpdateStatusComplex(usd discordgo.UpdateStatusData) error {
+	return r.record("UpdateStatusComplex", func() {
+		r.status = append(r.status, usd)
+	})
+}
+
+func (r *Recorder) Guild(guildID string, _ ...discordgo.RequestOption) (*discordgo.Guild, error) {
+	var guild *discordgo.Guild
+	err := r.record("Guild", func() {
+		guild = r.guilds[guildID]
+		if guild == nil {
+			guild = &discordgo.Guild{ID: guildID}
+		}
+	})
+	return guild, err
+}
+
+func (r *Recorder) ApplicationCommandCreate(_ string, guildID string, cmd *discordgo.ApplicationCommand, _ ...discordgo.RequestOption) (*discordgo.ApplicationCommand, error) {
+	var created discordgo.ApplicationCommand
+	err := r.recordIn(guildID, "ApplicationCommandCreate", func() {
+		created = *cmd
+		created.ID = r.newID("command")
+		created.GuildID = guildID
+		r.commands[guildID] = append(r.commands[guildID], &created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (r *Recorder) ApplicationCommands(_ string, guildID string, _ ...discordgo.RequestOption) ([]*discordgo.ApplicationCommand, error) {
+	var commands []*discordgo.ApplicationCommand
+	err := r.record("ApplicationCommands", func() {
+		commands = slices.Clone(r.commands[guildID])
+	})
+	return commands, err
+}
+
+func (r *Recorder) ApplicationCommandDelete(_ string, guildID, cmdID string, _ ...discordgo.RequestOption) error {
+	found := false
+	err := r.record("ApplicationCommandDelete", func() {
+		r.commands[guildID] = slices.DeleteFunc(r.commands[guildID], func(cmd *discordgo.ApplicationCommand) bool {
+			found = found || cmd.ID == cmdID
+			return cmd.ID == cmdID
+		})
+	})
+	if err == nil && !found {
+		err = errors.Newf("unknown command %s in guild %s", cmdID, guildID)
+	}
+	return err
+}
+
+func (r *Recorder) InteractionRespond(interaction *discordgo.Interaction, resp *discordgo.InteractionResponse, _ ...discordgo.RequestOption) error {
+	return r.record("InteractionRespond", func() {
+		r.responses[interaction.ID] = resp
+	})
+}
+
+func (r *Recorder) InteractionResponseEdit(interaction *discordgo.Interaction, newresp *discordgo.WebhookEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	var msg *discordgo.Message
+	err := r.record("InteractionResponseEdit", func() {
+		r.edits = append(r.edits, Edit{InteractionID: interaction.ID, Edit: newresp})
+		msg = &discordgo.Message{ID: interaction.ID, ChannelID: interaction.ChannelID}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (r *Recorder) ForumThreadStartComplex(channelID string, threadData *discordgo.ThreadStart, messageData *discordgo.MessageSend, _ ...discordgo.RequestOption) (*discordgo.Channel, error) {
+	var thread Thread
+	err := r.record("ForumThreadStartComplex", func() {
+		thread = Thread{
+			ID:      r.newID("thread"),
+			ForumID: channelID,
+			Name:    threadData.Name,
+			Message: messageData,
+		}
+		r.threads = append(r.threads, thread)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &discordgo.Channel{
+		ID:       thread.ID,
+		ParentID: channelID,
+		Name:     thread.Name,
+		Type:     discordgo.ChannelTypeGuildPublicThread,
+	}, nil
+}
+
+func (r *Recorder) ChannelMessageSendComplex(channelID string, data *discordgo.MessageSend, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	var message Message
+	err := r.record("ChannelMessageSendComplex", func() {
+		message = Message{
+			ID:        r.newID("message"),
+			ChannelID: channelID,
+			Message:   data,
+		}
+		r.messages = append(r.messages, message)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &discordgo.Message{
+		ID:        message.ID,
+		ChannelID: channelID,
+		Content:   data.Content,
+		Embeds:    data.Embeds,
+	}, nil
+}
+
+func (r *Recorder) ChannelMessageEditComplex(m *discordgo.MessageEdit, _ ...discordgo.RequestOption) (*discordgo.Message, error) {
+	found := false
+	err := r.record("ChannelMessageEditComplex", func() {
+		if found = r.message(m.Channel, m.ID); found {
+			r.msgEdits = append(r.msgEdits, m)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.Newf("unknown message %s in channel %s", m.ID, m.Channel)
+	}
+	msg := &discordgo.Message{ID: m.ID, ChannelID: m.Channel}
+	if m.Content != nil {
+		msg.Content = *m.Content
+	}
+	if m.Embeds != nil {
+		msg.Embeds = *m.Embeds
+	}
+	return msg, nil
+}
+
+func (r *Recorder) ChannelMessagePin(channelID, messageID string, _ ...discordgo.RequestOption) error {
+	found := false
+	err := r.record("ChannelMessagePin", func() {
+		if found = r.message(channelID, messageID); found {
+			r.pins[channelID] = append(r.pins[channelID], messageID)
+		}
+	})
+	if err == nil && !found {
+		err = errors.Newf("unknown message %s in channel %s", messageID, channelID)
+	}
+	return err
+}
+
+func (r *Recorder) GuildScheduledEventCreate(guildID string, params *discordgo.GuildScheduledEventParams, _ ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error) {
+	if params.ScheduledStartTime == nil || !params.ScheduledStartTime.After(time.Now()) {
+		return nil, errors.New("scheduled start time must be in the future")
+	}
+	var event discordgo.GuildScheduledEvent
+	err := r.record("GuildScheduledEventCreate", func() {
+		event = discordgo.GuildScheduledEvent{
+			ID:                 r.newID("event"),
+			GuildID:            guildID,
+			Name:               params.Name,
+			Description:        params.Description,
+			ScheduledStartTime: *params.ScheduledStartTime,
+			ScheduledEndTime:   params.ScheduledEndTime,
+			PrivacyLevel:       params.PrivacyLevel,
+			Status:             discordgo.GuildScheduledEventStatusScheduled,
+			EntityType:         params.EntityType,
+		}
+		if params.EntityMetadata != nil {
+			event.EntityMetadata = *params.EntityMetadata
+		}
+		stored := event
+		r.events = append(r.events, &stored)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *Recorder) GuildScheduledEventEdit(guildID, eventID string, params *discordgo.GuildScheduledEventParams, _ ...discordgo.RequestOption) (*discordgo.GuildScheduledEvent, error) {
+	var event *discordgo.GuildScheduledEvent
+	err := r.record("GuildScheduledEventEdit", func() {
+		i := slices.IndexFunc(r.events, func(e *discordgo.GuildScheduledEvent) bool {
+			return e.GuildID == guildID && e.ID == eventID
+		})
+		if i < 0 {
+			return
+		}
+		edited := *r.events[i]
+		if params.Name != "" {
+			edited.Name = params.Name
+		}
+		if params.Description != "" {
+			edited.Description = params.Description
+		}
+		if params.ScheduledStartTime != nil {
+			edited.ScheduledStartTime = *params.ScheduledStartTime
+		}
+		if params.ScheduledEndTime != nil {
+			edited.ScheduledEndTime = params.ScheduledEndTime
+		}
+		if params.Status != 0 {
+			edited.Status = params.Status
+		}
+		r.events[i] = &edited
+		event = &edited
+	})
+	if err == nil && event == nil {
+		err = errors.Newf("unknown event %s in guild %s", eventID, guildID)
+	}
+	return event, err
+}
@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	// eventLeadTime is how far ahead an event is scheduled when the session
+	// has no start time ahead, as Discord rejects events starting in the
+	// past.
+	eventLeadTime = time.Minute
+	// defaultEventDuration is the length of an event whose session has no
+	// end time, as Discord requires one for external events.
+	defaultEventDuration = 2 * time.Hour
+
+	topicURLFormat = "https://discord.com/channels/%s/%s"
+	eventLocation  = "19box"
+
+	// defaultEventName names the event of a session without a playlist
+	// name, as Discord requires one.
+	defaultEventName = "19box"
+	// maxEventNameLength is the longest event name Discord accepts.
+	maxEventNameLength = 100
+)
+
+// eventName returns the name of the event of sessionInfo.
+func eventName(sessionInfo *v1.SessionInfo) string {
+	if sessionInfo.GetPlaylistName() == "" {
+		return defaultEventName
+	}
+	return truncate(sessionInfo.PlaylistName, maxEventNameLength)
+}
+
+// eventTimes returns the start and end times of the event of sessionInfo.
+func eventTimes(sessionInfo *v1.SessionInfo) (time.Time, time.Time) {
+	start := time.Now().Add(eventLeadTime)
+	if scheduled, ok := scheduledStart(sessionInfo, time.Now()); ok && scheduled.After(start) {
+		start = scheduled
+	}
+	end := start.Add(defaultEventDuration)
+	if sessionInfo.GetScheduledEndTime() != "" {
+		if t, err := time.Parse(time.RFC3339, sessionInfo.ScheduledEndTime); err == nil && t.After(start) {
+			end = t
+		}
+	}
+	return start, end
+}
+
+// eventDescription links the event to the topic of g, if any.
+func eventDescription(g *guild) string {
+	topicID := g.getTopicID()
+	if topicID == "" {
+		return ""
+	}
+	return tr(g.locale, msgEventDescription, fmt.Sprintf(topicURLFormat, g.config.GuildID, topicID))
+}
+
+// scheduleEvent creates the scheduled event of the session in g unless it
+// already has one.
+func (b *Bot) scheduleEvent(g *guild, sessionInfo *v1.SessionInfo) error {
+	if !b.config.ScheduledEvents || g.getEventID() != "" {
+		return nil
+	}
+	location := sessionInfo.PlaylistUrl
+	if location == "" {
+		location = eventLocation
+	}
+	start, end := eventTimes(sessionInfo)
+	event, err := b.session.GuildScheduledEventCreate(g.config.GuildID, &discordgo.GuildScheduledEventParams{
+		Name:               eventName(sessionInfo),
+		Description:        eventDescription(g),
+		ScheduledStartTime: &start,
+		ScheduledEndTime:   &end,
+		PrivacyLevel:       discordgo.GuildScheduledEventPrivacyLevelGuildOnly,
+		EntityType:         discordgo.GuildScheduledEventEntityTypeExternal,
+		EntityMetadata:     &discordgo.GuildScheduledEventEntityMetadata{Location: location},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error creating scheduled event in guild %s", g.config.GuildID)
+	}
+	g.setEventID(event.ID)
+	b.saveState()
+	zlog.Info().Msgf("Created scheduled event: %s (ID: %s)", event.Name, event.ID)
+	return nil
+}
+
+// startEvent sets the scheduled event of g active, creating it if needed,
+// and links it to the topic.
+func (b *Bot) startEvent(g *guild, sessionInfo *v1.SessionInfo) error {
+	if !b.config.ScheduledEvents {
+		return nil
+	}
+	if err := b.scheduleEvent(g, sessionInfo); err != nil {
+		return err
+	}
+	_, err := b.session.GuildScheduledEventEdit(g.config.GuildID, g.getEventID(), &discordgo.GuildScheduledEventParams{
+		Description: eventDescription(g),
+		Status:      discordgo.GuildScheduledEventStatusActive,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error starting scheduled event %s", g.getEventID())
+	}
+	return nil
+}
+
+// endEvents completes the scheduled events of the session, or cancels them
+// when the session never started.
+func (b *Bot) endEvents(started bool) error {
+	status := discordgo.GuildScheduledEventStatusCompleted
+	if !started {
+		status = discordgo.GuildScheduledEventStatusCanceled
+	}
+	var errs []error
+	for _, g := range b.guilds {
+		eventID := g.getEventID()
+		if eventID == "" {
+			continue
+		}
+		_, err := b.session.GuildScheduledEventEdit(g.config.GuildID, eventID, &discordgo.GuildScheduledEventParams{
+			Status: status,
+		})
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "error ending scheduled event %s", eventID))
+		}
+	}
+	return errors.Join(errs...)
+}
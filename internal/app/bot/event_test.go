@@ -0,0 +1,22 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+)
+
+func TestEventName(t *testing.T) {
+	if got := eventName(&v1.SessionInfo{PlaylistName: "city pop night"}); got != "city pop night" {
+		t.Errorf("eventName = %q", got)
+	}
+	if got := eventName(&v1.SessionInfo{}); got != defaultEventName {
+		t.Errorf("eventName(no playlist name) = %q, want %q", got, defaultEventName)
+	}
+	got := eventName(&v1.SessionInfo{PlaylistName: strings.Repeat("夜", 150)})
+	if utf8.RuneCountInString(got) != maxEventNameLength || !strings.HasSuffix(got, "…") {
+		t.Errorf("eventName(long playlist name) = %q (%d characters), want %d", got, utf8.RuneCountInString(got), maxEventNameLength)
+	}
+}
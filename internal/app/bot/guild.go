@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"slices"
+	"sync/atomic"
+)
+
+// guild is the state the bot keeps for each configured guild.
+type guild struct {
+	config  GuildConfig
+	locale  string
+	iconURL atomic.Pointer[string]
+	topicID atomic.Pointer[string]
+	// nowPlayingID is the live now playing message in the topic.
+	nowPlayingID atomic.Pointer[string]
+	// eventID is the scheduled event mirroring the session.
+	eventID atomic.Pointer[string]
+	history history
+}
+
+func (g *guild) getIconURL() string {
+	if p := g.iconURL.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+func (g *guild) setIconURL(url string) {
+	g.iconURL.Store(&url)
+}
+
+func (g *guild) getTopicID() string {
+	if p := g.topicID.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+func (g *guild) setTopicID(id string) {
+	g.topicID.Store(&id)
+}
+
+func (g *guild) getNowPlayingID() string {
+	if p := g.nowPlayingID.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+func (g *guild) setNowPlayingID(id string) {
+	g.nowPlayingID.Store(&id)
+}
+
+func (g *guild) getEventID() string {
+	if p := g.eventID.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+func (g *guild) setEventID(id string) {
+	g.eventID.Store(&id)
+}
+
+// isAdmin reports whether roles include one of the guild's admin roles.
+func (g *guild) isAdmin(roles []string) bool {
+	for _, role := range g.config.AdminRoleIDs {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// guild returns the configured guild with guildID, or nil.
+func (b *Bot) guild(guildID string) *guild {
+	for _, g := range b.guilds {
+		if g.config.GuildID == guildID {
+			return g
+		}
+	}
+	return nil
+}
+
+// hasTopic reports whether any guild has a topic for the current session.
+func (b *Bot) hasTopic() bool {
+	for _, g := range b.guilds {
+		if g.getTopicID() != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// clearTopics forgets the topics, their now playing messages and the
+// scheduled events.
+func (b *Bot) clearTopics() {
+	for _, g := range b.guilds {
+		g.setTopicID("")
+		g.setNowPlayingID("")
+		g.setEventID("")
+	}
+}
@@ -0,0 +1,242 @@
+package bot
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	"github.com/osa030/19box-discordbot/internal/spotify"
+	"github.com/osa030/19box-discordbot/internal/store"
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	// historyLimit is how many tracks the history of a guild keeps. The
+	// least recently played or requested ones are forgotten first.
+	historyLimit = 500
+	// maxAutocompleteChoices is the most choices Discord accepts.
+	maxAutocompleteChoices = 25
+	// maxChoiceLength is the longest choice name Discord accepts.
+	maxChoiceLength = 100
+)
+
+// history is the tracks played or requested in a guild, across sessions.
+type history struct {
+	mu     sync.Mutex
+	tracks []store.HistoryTrack
+}
+
+func (h *history) set(tracks []store.HistoryTrack) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tracks = tracks
+}
+
+// add records a play of trackInfo and returns the updated history.
+func (h *history) add(trackInfo *v1.TrackInfo, now time.Time) []store.HistoryTrack {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := slices.IndexFunc(h.tracks, func(t store.HistoryTrack) bool {
+		return t.TrackID == trackInfo.TrackId
+	})
+	if i < 0 {
+		h.tracks = append(h.tracks, store.HistoryTrack{TrackID: trackInfo.TrackId})
+		i = len(h.tracks) - 1
+	}
+	track := &h.tracks[i]
+	track.Name = trackInfo.Name
+	track.Artists = trackInfo.Artists
+	track.URL = trackInfo.Url
+	track.AlbumArtURL = trackInfo.AlbumArtUrl
+	track.Plays++
+	track.LastPlayedAt = now
+	return h.trim()
+}
+
+// addRequest records an accepted request of track and returns the updated
+// history. The name and artists of tracks played before are kept.
+func (h *history) addRequest(track batchTrack, now time.Time) []store.HistoryTrack {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := slices.IndexFunc(h.tracks, func(t store.HistoryTrack) bool {
+		return t.TrackID == track.ID
+	})
+	if i < 0 {
+		h.tracks = append(h.tracks, store.HistoryTrack{
+			TrackID:     track.ID,
+			Name:        track.Name,
+			Artists:     track.Artists,
+			AlbumArtURL: track.AlbumArtURL,
+		})
+		i = len(h.tracks) - 1
+	}
+	h.tracks[i].Requests++
+	h.tracks[i].LastRequestedAt = now
+	return h.trim()
+}
+
+// trim forgets the least recently used tracks over historyLimit and returns
+// a copy of the history. h.mu must be held.
+func (h *history) trim() []store.HistoryTrack {
+	if len(h.tracks) > historyLimit {
+		slices.SortStableFunc(h.tracks, func(a, b store.HistoryTrack) int {
+			return byLastUsed(b, a)
+		})
+		h.tracks = h.tracks[:historyLimit]
+	}
+	return slices.Clone(h.tracks)
+}
+
+// find returns the track trackID, if it has been played or requested.
+func (h *history) find(trackID string) (store.HistoryTrack, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := slices.IndexFunc(h.tracks, func(t store.HistoryTrack) bool {
+		return t.TrackID == trackID
+	})
+	if i < 0 {
+		return store.HistoryTrack{}, false
+	}
+	return h.tracks[i], true
+}
+
+// search returns the tracks whose name or artists contain query, the most
+// played first, or the most recently played or requested first when query is
+// empty.
+func (h *history) search(query string, limit int) []store.HistoryTrack {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var found []store.HistoryTrack
+	for _, track := range h.tracks {
+		if query == "" || matchesTrack(track, query) {
+			found = append(found, track)
+		}
+	}
+	slices.SortStableFunc(found, func(a, b store.HistoryTrack) int {
+		if query != "" {
+			if c := cmp.Compare(b.Plays, a.Plays); c != 0 {
+				return c
+			}
+		}
+		return byLastUsed(b, a)
+	})
+	return found[:min(len(found), limit)]
+}
+
+func matchesTrack(track store.HistoryTrack, query string) bool {
+	if strings.Contains(strings.ToLower(track.Name), query) {
+		return true
+	}
+	return slices.ContainsFunc(track.Artists, func(artist string) bool {
+		return strings.Contains(strings.ToLower(artist), query)
+	})
+}
+
+// byLastUsed orders tracks by when they were last played or requested.
+func byLastUsed(a, b store.HistoryTrack) int {
+	return lastUsed(a).Compare(lastUsed(b))
+}
+
+func lastUsed(track store.HistoryTrack) time.Time {
+	if track.LastRequestedAt.After(track.LastPlayedAt) {
+		return track.LastRequestedAt
+	}
+	return track.LastPlayedAt
+}
+
+// loadHistory loads the track history of every guild.
+func (b *Bot) loadHistory() error {
+	for _, g := range b.guilds {
+		tracks, err := b.store.LoadHistory(g.config.GuildID)
+		if err != nil {
+			return err
+		}
+		g.history.set(tracks)
+	}
+	return nil
+}
+
+// recordHistory adds trackInfo to the history of every guild the session is
+// posted to.
+func (b *Bot) recordHistory(trackInfo *v1.TrackInfo) {
+	now := time.Now()
+	for _, g := range b.guilds {
+		if g.getTopicID() == "" {
+			continue
+		}
+		tracks := g.history.add(trackInfo, now)
+		if err := b.store.SaveHistory(g.config.GuildID, tracks); err != nil {
+			zlog.Error().Msgf("Error saving track history: %v", err)
+		}
+	}
+}
+
+// recordRequest adds track, accepted by the server, to the history of the
+// guild it was requested in. Tracks whose name is not known are left out, as
+// they cannot be suggested.
+func (b *Bot) recordRequest(i *discordgo.InteractionCreate, track batchTrack) {
+	g := b.guild(i.GuildID)
+	if g == nil || track.Name == "" {
+		return
+	}
+	tracks := g.history.addRequest(track, time.Now())
+	if err := b.store.SaveHistory(g.config.GuildID, tracks); err != nil {
+		zlog.Error().Msgf("Error saving track history: %v", err)
+	}
+}
+
+// handleAutocomplete suggests tracks from the history of the guild while the
+// URL of /req is typed.
+func (b *Bot) handleAutocomplete(i *discordgo.InteractionCreate) {
+	data := i.ApplicationCommandData()
+	if data.Name != cmdRequestName {
+		return
+	}
+	var query string
+	for _, option := range data.Options {
+		if option.Focused {
+			query = option.StringValue()
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	// a pasted link is submitted as it is
+	if _, err := spotify.Parse(query); err != nil {
+		if g := b.guild(i.GuildID); g != nil {
+			for _, track := range g.history.search(query, maxAutocompleteChoices) {
+				choices = append(choices, createTrackChoice(track))
+			}
+		}
+	}
+
+	err := b.session.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+	if err != nil {
+		zlog.Error().Msgf("Autocomplete response failed: %v", err)
+	}
+}
+
+func createTrackChoice(track store.HistoryTrack) *discordgo.ApplicationCommandOptionChoice {
+	name := track.Name
+	if len(track.Artists) > 0 {
+		name += " / " + strings.Join(track.Artists, ", ")
+	}
+	if runes := []rune(name); len(runes) > maxChoiceLength {
+		name = string(runes[:maxChoiceLength-1]) + "…"
+	}
+	url := track.URL
+	if url == "" {
+		url = spotify.Link{Kind: spotify.KindTrack, ID: track.TrackID}.URL()
+	}
+	return &discordgo.ApplicationCommandOptionChoice{Name: name, Value: url}
+}
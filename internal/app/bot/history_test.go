@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	"github.com/osa030/19box-discordbot/internal/jukebox/jukeboxtest"
+)
+
+func TestHistory(t *testing.T) {
+	var h history
+	now := time.Date(2025, 1, 1, 20, 0, 0, 0, time.Local)
+	play := func(id string) {
+		now = now.Add(time.Minute)
+		h.add(jukeboxtest.Track(id, v1.TrackState_TRACK_STATE_STARTED), now)
+	}
+	for _, id := range []string{"t1", "t2", "t1", "t3"} {
+		play(id)
+	}
+
+	var got []string
+	for _, track := range h.search("track", maxAutocompleteChoices) {
+		got = append(got, fmt.Sprintf("%s:%d", track.TrackID, track.Plays))
+	}
+	if want := "[t1:2 t3:1 t2:1]"; fmt.Sprint(got) != want {
+		t.Errorf("search = %v, want %s", got, want)
+	}
+
+	for n := range historyLimit {
+		play(fmt.Sprintf("n%d", n))
+	}
+	if len(h.tracks) != historyLimit {
+		t.Fatalf("history = %d tracks, want %d", len(h.tracks), historyLimit)
+	}
+	if found := h.search("t1", 1); len(found) != 0 {
+		t.Errorf("least recently played track kept: %+v", found)
+	}
+}
+
+func TestHistoryRequests(t *testing.T) {
+	var h history
+	now := time.Date(2025, 1, 1, 20, 0, 0, 0, time.Local)
+	h.add(jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_STARTED), now)
+	h.addRequest(batchTrack{ID: "t2", Name: "requested t2"}, now.Add(time.Minute))
+	tracks := h.addRequest(batchTrack{ID: "t1", Name: "other name"}, now.Add(2*time.Minute))
+
+	t1, _ := h.find("t1")
+	if t1.Name != "track t1" || t1.Plays != 1 || t1.Requests != 1 {
+		t.Errorf("played and requested track = %+v, want its played name kept", t1)
+	}
+	var got []string
+	for _, track := range h.search("", maxAutocompleteChoices) {
+		got = append(got, track.TrackID)
+	}
+	if want := "[t1 t2]"; fmt.Sprint(got) != want || len(tracks) != 2 {
+		t.Errorf("search = %v, want %s", got, want)
+	}
+
+	// a recent request keeps a track over ones played longer ago
+	for n := range historyLimit - 1 {
+		h.add(jukeboxtest.Track(fmt.Sprintf("n%d", n), v1.TrackState_TRACK_STATE_STARTED), now.Add(-time.Hour))
+	}
+	if _, ok := h.find("t2"); !ok {
+		t.Error("recently requested track forgotten")
+	}
+	if len(h.tracks) != historyLimit {
+		t.Errorf("history = %d tracks, want %d", len(h.tracks), historyLimit)
+	}
+}
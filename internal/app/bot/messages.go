@@ -0,0 +1,373 @@
+package bot
+
+import (
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	localeJa      = "ja"
+	localeEn      = "en"
+	defaultLocale = localeJa
+)
+
+// Message IDs. The text of each message lives in catalog.
+const (
+	// Commands
+	cmdRequestDescription        = "cmd_request_description"
+	cmdOptionURLDesc             = "cmd_option_url_description"
+	cmdNowPlayingDescription     = "cmd_nowplaying_description"
+	cmdStatusDescription         = "cmd_status_description"
+	cmdAdminDescription          = "cmd_admin_description"
+	cmdAdminPauseDescription     = "cmd_admin_pause_description"
+	cmdAdminResumeDescription    = "cmd_admin_resume_description"
+	cmdAdminSkipDescription      = "cmd_admin_skip_description"
+	cmdAdminStopDescription      = "cmd_admin_stop_description"
+	cmdAdminKickDescription      = "cmd_admin_kick_description"
+	cmdAdminListenersDescription = "cmd_admin_listeners_description"
+	cmdAdminStatusDescription    = "cmd_admin_status_description"
+	cmdOptionUserDesc            = "cmd_option_user_description"
+	cmdRequestMessageLabel       = "cmd_request_message_label"
+	cmdRequestMultiDescription   = "cmd_request_multi_description"
+	cmdOptionURLsDesc            = "cmd_option_urls_description"
+
+	// Topic messages
+	msgSessionStartBody     = "session_start_body"
+	msgSessionEndBody       = "session_end_body"
+	msgSessionScheduledBody = "session_scheduled_body"
+	msgSessionReminder      = "session_reminder"
+	msgEventDescription     = "event_description"
+	msgNowPlayingBody       = "now_playing_body"
+	msgTimeUndetermined     = "time_undetermined"
+	msgTimeScheduled        = "time_scheduled"
+	msgActivityState        = "activity_state"
+
+	// Recap
+	embedRecapTitle          = "embed_recap_title"
+	embedRecapRequestsField  = "embed_recap_requests_field"
+	msgRecapTrackCount       = "recap_track_count"
+	msgRecapRequestCountLine = "recap_request_count_line"
+
+	// Session state lines
+	msgSessionPausedLine           = "session_paused_line"
+	msgSessionWaitingForTracksLine = "session_waiting_for_tracks_line"
+	msgSessionEndingLine           = "session_ending_line"
+	msgSessionWaitingLine          = "session_waiting_line"
+	msgRequestsOpenedLine          = "requests_opened_line"
+	msgRequestsClosedLine          = "requests_closed_line"
+
+	// Replies
+	msgInternalError         = "internal_error"
+	msgAdminForbidden        = "admin_forbidden"
+	msgAdminDone             = "admin_done"
+	msgAdminFailed           = "admin_failed"
+	msgAdminListenerNotFound = "admin_listener_not_found"
+	msgAdminNoListeners      = "admin_no_listeners"
+	msgAdminListenerLine     = "admin_listener_line"
+	msgAdminListenerKicked   = "admin_listener_kicked"
+	msgNoSession             = "no_session"
+	msgNoTrackPlaying        = "no_track_playing"
+	msgRequestsClosed        = "requests_closed"
+	msgRateLimited           = "rate_limited"
+	msgInvalidTrackURL       = "invalid_track_url"
+	msgRequestAccepted       = "request_accepted"
+	msgRequestRejected       = "request_rejected"
+
+	msgRequestQueued            = "request_queued"
+	msgRequestUserPending       = "request_user_pending"
+	msgRequestKicked            = "request_kicked"
+	msgRequestMarketRestriction = "request_market_restriction"
+	msgNotTrackURL              = "not_track_url"
+	msgSessionQuotaReached      = "session_quota_reached"
+	msgNoTrackInMessage         = "no_track_in_message"
+
+	msgMultiRequestTitle        = "multi_request_title"
+	msgMultiRequestNoTracks     = "multi_request_no_tracks"
+	msgMultiRequestNotLink      = "multi_request_not_link"
+	msgMultiRequestNotSupported = "multi_request_not_supported"
+	msgMultiRequestNoSpotify    = "multi_request_no_spotify"
+	msgMultiRequestNotFound     = "multi_request_not_found"
+	msgMultiRequestListFailed   = "multi_request_list_failed"
+	msgMultiRequestTruncated    = "multi_request_truncated"
+	msgMultiRequestStopped      = "multi_request_stopped"
+
+	// Status
+	msgQueueSize        = "queue_size"
+	msgListenerCount    = "listener_count"
+	msgAccepting        = "accepting"
+	msgNotAccepting     = "not_accepting"
+	msgStateWaiting     = "state_waiting"
+	msgStateRunning     = "state_running"
+	msgStatePaused      = "state_paused"
+	msgStateWaitTracks  = "state_waiting_for_tracks"
+	msgStateEnding      = "state_ending"
+	msgStateTerminated  = "state_terminated"
+	msgStateUnspecified = "state_unspecified"
+	embedStateField     = "embed_state_field"
+	embedRemainField    = "embed_remaining_field"
+	embedQueueField     = "embed_queue_field"
+	embedListenerField  = "embed_listener_field"
+	embedEndTimeField   = "embed_end_time_field"
+	embedAcceptField    = "embed_accept_field"
+
+	// Live now playing
+	embedProgressField = "embed_progress_field"
+	msgTrackPlaying    = "track_playing"
+	msgTrackPaused     = "track_paused"
+	msgTrackSkipped    = "track_skipped"
+	msgTrackEnded      = "track_ended"
+)
+
+// catalog holds the message bundles keyed by locale and message ID.
+var catalog = map[string]map[string]string{
+	localeJa: {
+		cmdRequestDescription:        "楽曲リクエスト受付コマンド",
+		cmdOptionURLDesc:             "Spotifyの楽曲URLを入力してください",
+		cmdNowPlayingDescription:     "再生中の曲を表示します",
+		cmdStatusDescription:         "セッションの状態を表示します",
+		cmdAdminDescription:          "19box管理コマンド",
+		cmdAdminPauseDescription:     "再生を一時停止します",
+		cmdAdminResumeDescription:    "再生を再開します",
+		cmdAdminSkipDescription:      "再生中の曲をスキップします",
+		cmdAdminStopDescription:      "セッションを終了します",
+		cmdAdminKickDescription:      "リスナーをキックします",
+		cmdAdminListenersDescription: "参加中のリスナーを表示します",
+		cmdAdminStatusDescription:    "セッションの状態を表示します",
+		cmdOptionUserDesc:            "対象のユーザー",
+		cmdRequestMessageLabel:       "19boxにリクエスト",
+		cmdRequestMultiDescription:   "複数の曲やアルバム・プレイリストをまとめてリクエストします",
+		cmdOptionURLsDesc:            "スペース区切りの曲のURL、またはアルバム・プレイリストのURL",
+
+		msgSessionStartBody:     "🔊 セッションを開始しました。\n\n🔚: %s\n",
+		msgSessionEndBody:       "🔊 セッションは終了しました。\n\n本日のプレイリストはコチラです。\n",
+		msgSessionScheduledBody: "📅 %sからセッションを開始します。\n\n🔚: %s\n",
+		msgSessionReminder:      "⏰ あと%d分でセッションが始まります",
+		msgEventDescription:     "🎧 スレッド: %s",
+		msgNowPlayingBody:       "🎙️ nowplaying「%s」%s\n\n%s\n",
+		msgTimeUndetermined:     "終了時間未定",
+		msgTimeScheduled:        "%s終了予定",
+		msgActivityState:        "🎵 Spotifyの曲を共有中",
+
+		embedRecapTitle:          "📜 セットリスト (%d/%d)",
+		embedRecapRequestsField:  "リクエスト数",
+		msgRecapTrackCount:       "全%d曲",
+		msgRecapRequestCountLine: "%s: %d曲\n",
+
+		msgSessionPausedLine:           "⏸️ 一時停止中",
+		msgSessionWaitingForTracksLine: "⏳ リクエスト待ち — /req で曲を追加してください",
+		msgSessionEndingLine:           "🔚 受付終了",
+		msgSessionWaitingLine:          "🕒 開始待ち",
+		msgRequestsOpenedLine:          "📬 リクエスト受付を開始しました — /req で曲を追加してください",
+		msgRequestsClosedLine:          "📪 リクエスト受付を停止しました",
+
+		msgInternalError:         "受付に失敗しました(内部エラー)",
+		msgAdminForbidden:        "このコマンドを実行する権限がありません",
+		msgAdminDone:             "完了しました",
+		msgAdminFailed:           "失敗しました: %s",
+		msgAdminListenerNotFound: "<@%s> はリスナーとして参加していません",
+		msgAdminNoListeners:      "参加中のリスナーはいません",
+		msgAdminListenerLine:     "- %s (リクエスト待ち: %d曲)%s\n",
+		msgAdminListenerKicked:   " 🚫キック済み",
+		msgNoSession:             "現在開催中のセッションはありません",
+		msgNoTrackPlaying:        "現在再生中の曲はありません",
+		msgRequestsClosed:        "現在リクエストは受け付けていません。受付が再開されるまでお待ちください",
+		msgRateLimited:           "リクエストが続いています。<t:%d:R>にもう一度お試しください",
+		msgInvalidTrackURL:       "Spotifyの曲のURLを指定してください（例: https://open.spotify.com/track/...）",
+		msgRequestAccepted:       "✅ リクエストを受け付けました",
+		msgRequestRejected:       "⚠️ リクエストできませんでした",
+
+		msgRequestQueued:            "キューに追加しました。再生をお楽しみに！",
+		msgRequestUserPending:       "前のリクエストがまだ再生されていません。再生されてから次の曲をリクエストしてください",
+		msgRequestKicked:            "このセッションではリクエストできません",
+		msgRequestMarketRestriction: "この曲は地域の制限により再生できません",
+		msgNotTrackURL:              "アルバムやプレイリストはリクエストできません。曲のURLを指定してください",
+		msgSessionQuotaReached:      "このセッションでリクエストできるのは%d曲までです。次のセッションでまたどうぞ",
+		msgNoTrackInMessage:         "このメッセージにはSpotifyの曲のリンクがありません",
+		msgMultiRequestTitle:        "%d/%d曲のリクエストを受け付けました",
+		msgMultiRequestNoTracks:     "リクエストできる曲がありませんでした",
+		msgMultiRequestNotLink:      "Spotifyのリンクではありません",
+		msgMultiRequestNotSupported: "曲・アルバム・プレイリスト以外はリクエストできません",
+		msgMultiRequestNoSpotify:    "アルバムやプレイリストには対応していません。曲のURLを指定してください",
+		msgMultiRequestNotFound:     "見つからないか、非公開です",
+		msgMultiRequestListFailed:   "曲の一覧を取得できませんでした",
+		msgMultiRequestTruncated:    "一度にリクエストできるのは%d曲までのため、残りは省きました",
+		msgMultiRequestStopped:      "残りの%d曲はリクエストしませんでした",
+
+		msgQueueSize:        "%d曲",
+		msgListenerCount:    "%d人",
+		msgAccepting:        "受付中",
+		msgNotAccepting:     "受付停止中",
+		msgStateWaiting:     "開始前",
+		msgStateRunning:     "再生中",
+		msgStatePaused:      "一時停止中",
+		msgStateWaitTracks:  "リクエスト待ち",
+		msgStateEnding:      "受付終了",
+		msgStateTerminated:  "終了",
+		msgStateUnspecified: "不明",
+		embedStateField:     "状態",
+		embedRemainField:    "残り時間",
+		embedQueueField:     "キュー",
+		embedListenerField:  "リスナー",
+		embedEndTimeField:   "終了時間",
+		embedAcceptField:    "リクエスト",
+
+		embedProgressField: "再生位置",
+		msgTrackPlaying:    "▶️ 再生中",
+		msgTrackPaused:     "⏸️ 一時停止中",
+		msgTrackSkipped:    "⏭️ スキップされました",
+		msgTrackEnded:      "⏹️ セッション終了",
+	},
+	localeEn: {
+		cmdRequestDescription:        "Request a track",
+		cmdOptionURLDesc:             "Spotify track URL",
+		cmdNowPlayingDescription:     "Show the track currently playing",
+		cmdStatusDescription:         "Show the session status",
+		cmdAdminDescription:          "19box admin commands",
+		cmdAdminPauseDescription:     "Pause playback",
+		cmdAdminResumeDescription:    "Resume playback",
+		cmdAdminSkipDescription:      "Skip the current track",
+		cmdAdminStopDescription:      "Stop the session",
+		cmdAdminKickDescription:      "Kick a listener",
+		cmdAdminListenersDescription: "List the joined listeners",
+		cmdAdminStatusDescription:    "Show the session status",
+		cmdOptionUserDesc:            "Target user",
+		cmdRequestMessageLabel:       "Request on 19box",
+		cmdRequestMultiDescription:   "Request several tracks, or an album or playlist, at once",
+		cmdOptionURLsDesc:            "Track URLs separated by spaces, or an album or playlist URL",
+
+		msgSessionStartBody:     "🔊 The session has started.\n\n🔚: %s\n",
+		msgSessionEndBody:       "🔊 The session has ended.\n\nHere is today's playlist.\n",
+		msgSessionScheduledBody: "📅 The session starts at %s.\n\n🔚: %s\n",
+		msgSessionReminder:      "⏰ The session starts in %d minutes",
+		msgEventDescription:     "🎧 Thread: %s",
+		msgNowPlayingBody:       "🎙️ now playing \"%s\" %s\n\n%s\n",
+		msgTimeUndetermined:     "End time undetermined",
+		msgTimeScheduled:        "Ends at %s",
+		msgActivityState:        "🎵 Sharing Spotify tracks",
+
+		embedRecapTitle:          "📜 Set list (%d/%d)",
+		embedRecapRequestsField:  "Requests",
+		msgRecapTrackCount:       "%d tracks",
+		msgRecapRequestCountLine: "%s: %d\n",
+
+		msgSessionPausedLine:           "⏸️ Paused",
+		msgSessionWaitingForTracksLine: "⏳ Waiting for requests — add a track with /req",
+		msgSessionEndingLine:           "🔚 Requests closed",
+		msgSessionWaitingLine:          "🕒 Waiting to start",
+		msgRequestsOpenedLine:          "📬 Requests are open — add a track with /req",
+		msgRequestsClosedLine:          "📪 Requests are closed",
+
+		msgInternalError:         "Request failed (internal error)",
+		msgAdminForbidden:        "You are not allowed to use this command",
+		msgAdminDone:             "Done",
+		msgAdminFailed:           "Failed: %s",
+		msgAdminListenerNotFound: "<@%s> has not joined as a listener",
+		msgAdminNoListeners:      "No listeners have joined",
+		msgAdminListenerLine:     "- %s (pending: %d)%s\n",
+		msgAdminListenerKicked:   " 🚫kicked",
+		msgNoSession:             "No session is running",
+		msgNoTrackPlaying:        "Nothing is playing right now",
+		msgRequestsClosed:        "Requests are closed right now. Please wait until they reopen",
+		msgRateLimited:           "You are requesting too fast. Please try again <t:%d:R>",
+		msgInvalidTrackURL:       "Please specify a Spotify track URL (e.g. https://open.spotify.com/track/...)",
+		msgRequestAccepted:       "✅ Request accepted",
+		msgRequestRejected:       "⚠️ Request not accepted",
+
+		msgRequestQueued:            "Added to the queue. Stay tuned!",
+		msgRequestUserPending:       "Your previous request has not played yet. Please wait until it does",
+		msgRequestKicked:            "You cannot request tracks in this session",
+		msgRequestMarketRestriction: "This track is not available in this region",
+		msgNotTrackURL:              "Albums and playlists cannot be requested. Please specify a track URL",
+		msgSessionQuotaReached:      "You can request up to %d tracks per session. See you next session",
+		msgNoTrackInMessage:         "This message has no Spotify track link",
+		msgMultiRequestTitle:        "%d of %d requests accepted",
+		msgMultiRequestNoTracks:     "No tracks to request",
+		msgMultiRequestNotLink:      "Not a Spotify link",
+		msgMultiRequestNotSupported: "Only tracks, albums and playlists can be requested",
+		msgMultiRequestNoSpotify:    "Albums and playlists are not supported. Please specify track URLs",
+		msgMultiRequestNotFound:     "Not found, or private",
+		msgMultiRequestListFailed:   "Could not list the tracks",
+		msgMultiRequestTruncated:    "Up to %d tracks can be requested at once; the rest were left out",
+		msgMultiRequestStopped:      "The remaining %d tracks were not requested",
+
+		msgQueueSize:        "%d tracks",
+		msgListenerCount:    "%d listeners",
+		msgAccepting:        "Open",
+		msgNotAccepting:     "Closed",
+		msgStateWaiting:     "Not started",
+		msgStateRunning:     "Playing",
+		msgStatePaused:      "Paused",
+		msgStateWaitTracks:  "Waiting for requests",
+		msgStateEnding:      "Requests closed",
+		msgStateTerminated:  "Ended",
+		msgStateUnspecified: "Unknown",
+		embedStateField:     "State",
+		embedRemainField:    "Remaining",
+		embedQueueField:     "Queue",
+		embedListenerField:  "Listeners",
+		embedEndTimeField:   "End time",
+		embedAcceptField:    "Requests",
+
+		embedProgressField: "Progress",
+		msgTrackPlaying:    "▶️ Playing",
+		msgTrackPaused:     "⏸️ Paused",
+		msgTrackSkipped:    "⏭️ Skipped",
+		msgTrackEnded:      "⏹️ Session ended",
+	},
+}
+
+// discordLocales maps the Discord locales that have a bundle to it.
+var discordLocales = map[discordgo.Locale]string{
+	discordgo.Japanese:  localeJa,
+	discordgo.EnglishUS: localeEn,
+	discordgo.EnglishGB: localeEn,
+}
+
+// tr returns message id in locale formatted with args, falling back to the
+// default locale when the bundle lacks it.
+func tr(locale string, id string, args ...any) string {
+	text, ok := catalog[locale][id]
+	if !ok {
+		text, ok = catalog[defaultLocale][id]
+	}
+	if !ok {
+		return id
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// localizations returns message id for every Discord locale with a bundle,
+// for use as command name or description localizations.
+func localizations(id string) *map[discordgo.Locale]string {
+	texts := map[discordgo.Locale]string{}
+	for discordLocale, locale := range discordLocales {
+		if text, ok := catalog[locale][id]; ok {
+			texts[discordLocale] = text
+		}
+	}
+	return &texts
+}
+
+// locale returns the bundle to reply to i with: the invoking user's locale
+// when there is a bundle for it, otherwise the guild's locale.
+func (b *Bot) locale(i *discordgo.InteractionCreate) string {
+	if locale, ok := discordLocales[i.Locale]; ok {
+		return locale
+	}
+	if g := b.guild(i.GuildID); g != nil {
+		return g.locale
+	}
+	return b.defaultLocale()
+}
+
+// defaultLocale returns the configured default locale.
+func (b *Bot) defaultLocale() string {
+	if b.config.Locale != "" {
+		return b.config.Locale
+	}
+	return defaultLocale
+}
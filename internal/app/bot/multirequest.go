@@ -0,0 +1,246 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	"github.com/osa030/19box-discordbot/internal/spotify"
+	zlog "github.com/rs/zerolog/log"
+)
+
+const (
+	cmdRequestMultiName = "req-multi"
+	cmdOptionURLsName   = "urls"
+
+	// maxInputLength is how much of an unusable link is quoted back.
+	maxInputLength = 60
+	// lookupTrackTimeout bounds the lookup of a requested track, which only
+	// decorates the reply.
+	lookupTrackTimeout = 2 * time.Second
+)
+
+// trackLister lists the tracks of album and playlist links.
+type trackLister interface {
+	Tracks(ctx context.Context, link spotify.Link, limit int) ([]spotify.Track, error)
+}
+
+// trackFinder looks up single tracks.
+type trackFinder interface {
+	Track(ctx context.Context, trackID string) (spotify.Track, error)
+}
+
+// batchStopCodes are the results after which the rest of a /req-multi batch
+// would be rejected too, so it is not requested.
+var batchStopCodes = []jukebox.RequestCode{
+	jukebox.RequestCodeUserPending,
+	jukebox.RequestCodeKicked,
+}
+
+// batchTrack is a track to request in a /req-multi batch.
+type batchTrack struct {
+	ID string
+	// Name and Artists are known for tracks listed from an album or
+	// playlist, looked up, or played or requested in the guild before.
+	Name        string
+	Artists     []string
+	AlbumArtURL string
+}
+
+// label returns the track as a link titled by its name, or its URL when the
+// name is not known.
+func (t batchTrack) label() string {
+	url := spotify.Link{Kind: spotify.KindTrack, ID: t.ID}.URL()
+	if t.Name == "" {
+		return url
+	}
+	name := t.Name
+	if len(t.Artists) > 0 {
+		name += " / " + strings.Join(t.Artists, ", ")
+	}
+	return fmt.Sprintf("[%s](%s)", truncate(name, maxChoiceLength), url)
+}
+
+func requestMultiCommand(locale string) *discordgo.ApplicationCommand {
+	return &discordgo.ApplicationCommand{
+		Name:                     cmdRequestMultiName,
+		Description:              tr(locale, cmdRequestMultiDescription),
+		DescriptionLocalizations: localizations(cmdRequestMultiDescription),
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:                     discordgo.ApplicationCommandOptionString,
+				Name:                     cmdOptionURLsName,
+				Description:              tr(locale, cmdOptionURLsDesc),
+				DescriptionLocalizations: *localizations(cmdOptionURLsDesc),
+				Required:                 true,
+			},
+		},
+	}
+}
+
+// requestTracks requests the tracks of /req-multi one after another and
+// replies with the result of each.
+func (b *Bot) requestTracks(i *discordgo.InteractionCreate) {
+	locale := b.locale(i)
+	userID, displayName := interactionUser(i)
+	if userID == "" {
+		zlog.Error().Msg("User ID not found")
+		b.responseUpdate(i, tr(locale, msgInternalError))
+		return
+	}
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		zlog.Error().Msg("No options provided")
+		b.responseUpdate(i, tr(locale, msgInternalError))
+		return
+	}
+	input := options[0].StringValue()
+	zlog.Info().Msgf("Request tracks [%s] from user: ID=%s, Name=%s", input, userID, displayName)
+
+	if !b.isAccepting() {
+		zlog.Info().Msgf("Requests are closed, rejecting request from user: %s", userID)
+		b.responseUpdate(i, tr(locale, msgRequestsClosed))
+		return
+	}
+
+	tracks, lines := b.resolveTracks(i, input)
+	if len(tracks) == 0 && len(lines) == 0 {
+		b.responseUpdate(i, tr(locale, msgInvalidTrackURL))
+		return
+	}
+
+	accepted := 0
+	for n, track := range tracks {
+		if ok, reply := b.checkRequestLimits(i, userID); !ok {
+			lines = append(lines, reply, tr(locale, msgMultiRequestStopped, len(tracks)-n))
+			break
+		}
+		result, err := b.requestFor(userID, displayName, track.ID)
+		if err != nil {
+			b.refundRequest(i, userID)
+			lines = append(lines, fmt.Sprintf(multiRequestErrorLine, track.label(), tr(locale, msgInternalError)))
+			if left := len(tracks) - n - 1; left > 0 {
+				lines = append(lines, tr(locale, msgMultiRequestStopped, left))
+			}
+			break
+		}
+		if result.Success {
+			accepted++
+			b.recordRequest(i, track)
+			lines = append(lines, fmt.Sprintf(multiRequestAcceptedLine, track.label()))
+		} else {
+			lines = append(lines, fmt.Sprintf(multiRequestRejectedLine, track.label(), formatRequestResult(locale, result)))
+		}
+		if left := len(tracks) - n - 1; left > 0 && slices.Contains(batchStopCodes, result.Code) {
+			lines = append(lines, tr(locale, msgMultiRequestStopped, left))
+			break
+		}
+	}
+	zlog.Info().Msgf("Requested %d of %d tracks for user: %s", accepted, len(tracks), userID)
+	b.responseUpdateMessage(i, createMultiRequestMessage(locale, accepted, len(tracks), lines))
+}
+
+// resolveTracks parses the links in input, separated by spaces or commas, and
+// lists the tracks of albums and playlists, up to the configured limit. It
+// returns the tracks and a line for each link that could not be used.
+func (b *Bot) resolveTracks(i *discordgo.InteractionCreate, input string) ([]batchTrack, []string) {
+	locale := b.locale(i)
+	limit := b.config.multiRequestLimit()
+	var tracks []batchTrack
+	var lines []string
+	truncated := false
+	add := func(track batchTrack) {
+		if slices.ContainsFunc(tracks, func(t batchTrack) bool { return t.ID == track.ID }) {
+			return
+		}
+		if len(tracks) == limit {
+			truncated = true
+			return
+		}
+		tracks = append(tracks, track)
+	}
+	problem := func(field string, id string) {
+		quoted := fmt.Sprintf("`%s`", truncate(strings.Trim(field, "<>"), maxInputLength))
+		lines = append(lines, fmt.Sprintf(multiRequestErrorLine, quoted, tr(locale, id)))
+	}
+
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == '、' || strings.ContainsRune(" \t\n　", r)
+	})
+	for _, field := range fields {
+		link, err := spotify.Parse(field)
+		if err != nil {
+			zlog.Info().Msgf("Invalid link [%s]: %v", field, err)
+			problem(field, msgMultiRequestNotLink)
+			continue
+		}
+		switch link.Kind {
+		case spotify.KindTrack:
+			add(b.knownTrack(i, link.ID))
+		case spotify.KindAlbum, spotify.KindPlaylist:
+			if b.tracks == nil {
+				problem(field, msgMultiRequestNoSpotify)
+				continue
+			}
+			// one more than fits, to tell whether any are left out
+			listed, err := b.listTracks(link, limit-len(tracks)+1)
+			if err != nil {
+				zlog.Error().Msgf("Error listing tracks of %s: %v", link.URL(), err)
+				if errors.Is(err, spotify.ErrNotFound) {
+					problem(field, msgMultiRequestNotFound)
+				} else {
+					problem(field, msgMultiRequestListFailed)
+				}
+				continue
+			}
+			for _, track := range listed {
+				add(batchTrack{ID: track.ID, Name: track.Name, Artists: track.Artists})
+			}
+		default:
+			problem(field, msgMultiRequestNotSupported)
+		}
+	}
+	if truncated {
+		lines = append(lines, tr(locale, msgMultiRequestTruncated, limit))
+	}
+	return tracks, lines
+}
+
+// knownTrack returns trackID with its name when it was played or requested
+// in the guild before.
+func (b *Bot) knownTrack(i *discordgo.InteractionCreate, trackID string) batchTrack {
+	if g := b.guild(i.GuildID); g != nil {
+		if track, ok := g.history.find(trackID); ok {
+			return batchTrack{ID: trackID, Name: track.Name, Artists: track.Artists, AlbumArtURL: track.AlbumArtURL}
+		}
+	}
+	return batchTrack{ID: trackID}
+}
+
+// lookupTrack returns trackID with its name, looking it up on Spotify when it
+// is not known in the guild. Only the ID is returned when the lookup fails.
+func (b *Bot) lookupTrack(i *discordgo.InteractionCreate, trackID string) batchTrack {
+	track := b.knownTrack(i, trackID)
+	if track.Name != "" || b.finder == nil {
+		return track
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTrackTimeout)
+	defer cancel()
+	found, err := b.finder.Track(ctx, trackID)
+	if err != nil {
+		zlog.Warn().Msgf("Error looking up track %s: %v", trackID, err)
+		return track
+	}
+	return batchTrack{ID: trackID, Name: found.Name, Artists: found.Artists, AlbumArtURL: found.AlbumArtURL}
+}
+
+func (b *Bot) listTracks(link spotify.Link, limit int) ([]spotify.Track, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return b.tracks.Tracks(ctx, link, limit)
+}
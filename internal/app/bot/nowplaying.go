@@ -0,0 +1,196 @@
+package bot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// nowPlayingRefreshInterval is how often the progress of the live now
+// playing message is updated between notifications.
+const nowPlayingRefreshInterval = 30 * time.Second
+
+// nowPlaying is the track shown by the live now playing message.
+type nowPlaying struct {
+	mu         sync.Mutex
+	track      *v1.TrackInfo
+	session    *v1.SessionInfo
+	duration   int32     // the largest RemainingSeconds seen for track
+	reportedAt time.Time // when track.RemainingSeconds was reported
+
+	// showMu serializes showNowPlaying, so that a message is posted only
+	// once per topic.
+	showMu sync.Mutex
+}
+
+func (n *nowPlaying) update(track *v1.TrackInfo, session *v1.SessionInfo) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.track.GetTrackId() != track.TrackId {
+		n.duration = 0
+	}
+	n.track = track
+	n.session = session
+	n.duration = max(n.duration, track.RemainingSeconds)
+	n.reportedAt = time.Now()
+}
+
+// get returns the current track with its elapsed and total seconds, or nil.
+func (n *nowPlaying) get() (*v1.TrackInfo, *v1.SessionInfo, int32, int32) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.track == nil {
+		return nil, nil, 0, 0
+	}
+	remaining := n.track.RemainingSeconds
+	if isTrackPlaying(n.track) {
+		remaining = max(0, remaining-int32(time.Since(n.reportedAt).Seconds()))
+	}
+	return n.track, n.session, n.duration - remaining, n.duration
+}
+
+func (n *nowPlaying) isPlaying() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.track != nil && isTrackPlaying(n.track)
+}
+
+func (n *nowPlaying) clear() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.track = nil
+	n.session = nil
+	n.duration = 0
+}
+
+func isTrackPlaying(trackInfo *v1.TrackInfo) bool {
+	return trackInfo.State == v1.TrackState_TRACK_STATE_STARTED || trackInfo.State == v1.TrackState_TRACK_STATE_PLAYING
+}
+
+// handleTrackUpdate reflects a resumed, paused or skipped track in the live
+// now playing message.
+func (b *Bot) handleTrackUpdate(notification *jukebox.Notification) {
+	trackInfo := notification.Track
+	if !b.config.LiveNowPlaying || trackInfo == nil {
+		return
+	}
+	zlog.Info().Msgf("Track %s: %s", trackInfo.State, trackInfo.Name)
+	b.nowPlaying.update(trackInfo, notification.Session)
+	if err := b.showNowPlaying(); err != nil {
+		zlog.Error().Msgf("Error updating now playing: %v", err)
+	}
+}
+
+// refreshNowPlaying keeps the progress of the live now playing message
+// moving while the track plays.
+func (b *Bot) refreshNowPlaying() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(nowPlayingRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			if !b.nowPlaying.isPlaying() {
+				continue
+			}
+			if err := b.showNowPlaying(); err != nil {
+				zlog.Error().Msgf("Error refreshing now playing: %v", err)
+			}
+		}
+	}
+}
+
+// showNowPlaying edits the live now playing message of every topic to show
+// the current track, posting and pinning the message where there is none.
+func (b *Bot) showNowPlaying() error {
+	b.nowPlaying.showMu.Lock()
+	defer b.nowPlaying.showMu.Unlock()
+
+	trackInfo, sessionInfo, elapsed, duration := b.nowPlaying.get()
+	if trackInfo == nil {
+		return nil
+	}
+	var errs []error
+	for _, g := range b.guilds {
+		topicID := g.getTopicID()
+		if topicID == "" {
+			continue
+		}
+		msg := createNowPlayingMessage(g.locale, trackInfo, sessionInfo)
+		msg = b.templates.nowPlaying.apply(msg, newTemplateData(g.locale, trackInfo, sessionInfo))
+		msg = addNowPlayingProgress(g.locale, msg, trackStateLabels[trackInfo.State], elapsed, duration)
+		if err := b.showNowPlayingIn(g, topicID, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// endNowPlaying edits the live now playing message of every topic to show
+// the last track as ended, so that it does not go on playing after the
+// session, and stops refreshing it.
+func (b *Bot) endNowPlaying() error {
+	b.nowPlaying.showMu.Lock()
+	defer b.nowPlaying.showMu.Unlock()
+
+	trackInfo, sessionInfo, elapsed, duration := b.nowPlaying.get()
+	if trackInfo == nil {
+		return nil
+	}
+	defer b.nowPlaying.clear()
+	var errs []error
+	for _, g := range b.guilds {
+		topicID, messageID := g.getTopicID(), g.getNowPlayingID()
+		if topicID == "" || messageID == "" {
+			continue
+		}
+		msg := createNowPlayingMessage(g.locale, trackInfo, sessionInfo)
+		msg = b.templates.nowPlaying.apply(msg, newTemplateData(g.locale, trackInfo, sessionInfo))
+		msg = addNowPlayingProgress(g.locale, msg, msgTrackEnded, elapsed, duration)
+		edit := discordgo.NewMessageEdit(topicID, messageID).SetContent(msg.Content)
+		if msg.Embed != nil {
+			edit.SetEmbed(msg.Embed)
+		}
+		if _, err := b.session.ChannelMessageEditComplex(edit); err != nil {
+			zlog.Error().Msgf("Error ending now playing message[%s]: %v", messageID, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Bot) showNowPlayingIn(g *guild, topicID string, msg *discordgo.MessageSend) error {
+	if messageID := g.getNowPlayingID(); messageID != "" {
+		edit := discordgo.NewMessageEdit(topicID, messageID).SetContent(msg.Content)
+		if msg.Embed != nil {
+			edit.SetEmbed(msg.Embed)
+		}
+		_, err := b.session.ChannelMessageEditComplex(edit)
+		if err == nil {
+			return nil
+		}
+		// the message may have been deleted, so post a new one
+		zlog.Warn().Msgf("Error editing now playing message[%s]: %v", messageID, err)
+	}
+
+	sent, err := b.session.ChannelMessageSendComplex(topicID, msg)
+	if err != nil {
+		zlog.Error().Msgf("Error sending now playing to topic: %v", err)
+		return err
+	}
+	g.setNowPlayingID(sent.ID)
+	b.saveState()
+	zlog.Info().Msgf("Sent now playing message to topic: %s (ID: %s)", sent.ChannelID, sent.ID)
+
+	if err := b.session.ChannelMessagePin(topicID, sent.ID); err != nil {
+		zlog.Error().Msgf("Error pinning now playing message: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// rateLimiter is a token bucket per Discord user. Each user can make burst
+// requests in a row and regains one every interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	burst    int
+	interval time.Duration
+	buckets  map[string]*bucket
+	now      func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(burst int, interval time.Duration) *rateLimiter {
+	return &rateLimiter{
+		burst:    burst,
+		interval: interval,
+		buckets:  map[string]*bucket{},
+		now:      time.Now,
+	}
+}
+
+// allow takes a token from the bucket of userID. When the bucket is empty it
+// returns false with the time the next token is available.
+func (l *rateLimiter) allow(userID string) (bool, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	// forget the users whose bucket has filled up again
+	for id, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.burst) {
+			delete(l.buckets, id)
+		}
+	}
+
+	b, ok := l.buckets[userID]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), updated: now}
+		l.buckets[userID] = b
+	}
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) * float64(l.interval))
+		return false, now.Add(wait)
+	}
+	b.tokens--
+	return true, time.Time{}
+}
+
+// refund gives back the token taken by allow for a request of userID that
+// did not reach the server.
+func (l *rateLimiter) refund(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[userID]; ok {
+		b.tokens = min(float64(l.burst), b.tokens+1)
+	}
+}
+
+// refill adds the tokens regained since the bucket was last updated.
+func (l *rateLimiter) refill(b *bucket, now time.Time) float64 {
+	b.tokens = min(float64(l.burst), b.tokens+float64(now.Sub(b.updated))/float64(l.interval))
+	b.updated = now
+	return b.tokens
+}
+
+// isRateLimitExempt reports whether the member who invoked i is not subject
+// to the request limits: admins of the guild and members with an exempt role.
+func (b *Bot) isRateLimitExempt(i *discordgo.InteractionCreate) bool {
+	if i.Member == nil {
+		return false
+	}
+	if g := b.guild(i.GuildID); g != nil && g.isAdmin(i.Member.Roles) {
+		return true
+	}
+	for _, role := range b.config.RateLimit.ExemptRoleIDs {
+		if slices.Contains(i.Member.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRequestLimits reports whether userID may request another track. When
+// not, it returns the reply telling the user when they can request again.
+func (b *Bot) checkRequestLimits(i *discordgo.InteractionCreate, userID string) (bool, string) {
+	limits := b.config.RateLimit
+	if (b.limiter == nil && limits.SessionQuota == 0) || b.isRateLimitExempt(i) {
+		return true, ""
+	}
+	if limits.SessionQuota > 0 {
+		if count, _ := b.requestCounts.Load(userID); count >= limits.SessionQuota {
+			zlog.Info().Msgf("Session quota reached for user: %s", userID)
+			return false, tr(b.locale(i), msgSessionQuotaReached, limits.SessionQuota)
+		}
+	}
+	if b.limiter != nil {
+		if ok, next := b.limiter.allow(userID); !ok {
+			zlog.Info().Msgf("Rate limited user: %s until %s", userID, next.Local().Format(time.TimeOnly))
+			return false, tr(b.locale(i), msgRateLimited, next.Unix())
+		}
+	}
+	return true, ""
+}
+
+// refundRequest gives back the rate limit token checkRequestLimits took
+// for a request of userID that failed before the server answered it.
+func (b *Bot) refundRequest(i *discordgo.InteractionCreate, userID string) {
+	if b.limiter == nil || b.isRateLimitExempt(i) {
+		return
+	}
+	b.limiter.refund(userID)
+}
+
+// countRequest counts a request of userID accepted by the server against
+// the session quota.
+func (b *Bot) countRequest(userID string) {
+	if b.config.RateLimit.SessionQuota == 0 {
+		return
+	}
+	b.requestCounts.Compute(userID, func(count int, _ bool) (int, bool) {
+		return count + 1, false
+	})
+	b.saveState()
+}
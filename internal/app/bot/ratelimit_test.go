@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for n := range 2 {
+		if ok, _ := l.allow("u1"); !ok {
+			t.Fatalf("request %d denied, want allowed within the burst", n+1)
+		}
+	}
+	ok, next := l.allow("u1")
+	if ok || !next.Equal(now.Add(time.Minute)) {
+		t.Errorf("allow = %v, %v, want denied until %v", ok, next, now.Add(time.Minute))
+	}
+	if ok, _ := l.allow("u2"); !ok {
+		t.Error("other user denied, want a bucket of their own")
+	}
+
+	// a refunded request does not count
+	l.refund("u2")
+	for n := range 2 {
+		if ok, _ := l.allow("u2"); !ok {
+			t.Errorf("request %d after a refund denied, want allowed", n+1)
+		}
+	}
+	l.refund("u2")
+	l.refund("u2")
+	l.refund("u2")
+	if got := l.buckets["u2"].tokens; got != 2 {
+		t.Errorf("tokens after refunds = %v, want at most the burst", got)
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, next := l.allow("u1"); ok || !next.Equal(now.Add(30*time.Second)) {
+		t.Errorf("allow after 30s = %v, %v, want denied for another 30s", ok, next)
+	}
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.allow("u1"); !ok {
+		t.Error("allow after a minute denied, want a regained request")
+	}
+
+	now = now.Add(time.Hour)
+	l.allow("u3")
+	if _, ok := l.buckets["u1"]; ok {
+		t.Error("full bucket of u1 kept, want it forgotten")
+	}
+}
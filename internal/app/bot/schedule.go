@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// reminders are the pending reminders of a waiting session.
+type reminders struct {
+	mu    sync.Mutex
+	stops []func() bool
+	now   func() time.Time
+	// afterFunc calls f after d, like time.AfterFunc, and returns a function
+	// that stops the call.
+	afterFunc func(d time.Duration, f func()) func() bool
+}
+
+func newReminders() *reminders {
+	return &reminders{
+		now: time.Now,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+	}
+}
+
+// schedule calls f at the time at.
+func (r *reminders) schedule(at time.Time, f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stops = append(r.stops, r.afterFunc(at.Sub(r.now()), f))
+}
+
+func (r *reminders) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stop := range r.stops {
+		stop()
+	}
+	r.stops = nil
+}
+
+// scheduledStart returns the scheduled start time of sessionInfo when it is
+// still ahead of now.
+func scheduledStart(sessionInfo *v1.SessionInfo, now time.Time) (time.Time, bool) {
+	if sessionInfo.GetScheduledStartTime() == "" {
+		return time.Time{}, false
+	}
+	start, err := time.Parse(time.RFC3339, sessionInfo.ScheduledStartTime)
+	if err != nil {
+		zlog.Warn().Msgf("Invalid scheduled start time [%s]: %v", sessionInfo.ScheduledStartTime, err)
+		return time.Time{}, false
+	}
+	return start, start.After(now)
+}
+
+// handleSessionWaiting announces a session scheduled to start later: it
+// creates the topic and the scheduled event ahead of time in every guild that
+// has none yet, and schedules the reminders. The topic is reused when the session starts.
+// Sessions without a start time get the plain state line.
+func (b *Bot) handleSessionWaiting(notification *jukebox.Notification) {
+	sessionInfo := notification.Session
+	start, ok := scheduledStart(sessionInfo, b.reminders.now())
+	if !ok {
+		b.handleSessionStateChange(notification)
+		return
+	}
+	b.swapSessionState(sessionInfo.GetState())
+
+	for _, g := range b.guilds {
+		if g.getTopicID() != "" {
+			continue
+		}
+
+		topicTitle := fmt.Sprintf(msgSessionStartTitle, start.Local().Format(timeFormatTopicTitle))
+		zlog.Info().Msgf("Creating topic[%s] ahead of the session in guild[%s]", topicTitle, g.config.GuildID)
+
+		content := tr(g.locale, msgSessionScheduledBody,
+			start.Local().Format(timeFormatDisplay),
+			formatSessionEnd(g.locale, sessionInfo.ScheduledEndTime),
+		)
+		topicMessage := createSessionMessage(content, sessionInfo, g.getIconURL())
+		if err := b.createForumTopic(g, topicTitle, topicMessage); err != nil {
+			zlog.Error().Msgf("Error creating forum topic: %v", err)
+		}
+	}
+	for _, g := range b.guilds {
+		if err := b.scheduleEvent(g, sessionInfo); err != nil {
+			zlog.Error().Msgf("Error scheduling event: %v", err)
+		}
+	}
+
+	b.scheduleReminders(sessionInfo.SessionId, start)
+}
+
+// scheduleReminders replaces the pending reminders with ones for the session
+// sessionID starting at start. Offsets already passed are skipped.
+func (b *Bot) scheduleReminders(sessionID string, start time.Time) {
+	b.reminders.stop()
+	now := b.reminders.now()
+	for _, offset := range b.config.reminderOffsets() {
+		at := start.Add(-offset)
+		if !at.After(now) {
+			continue
+		}
+		zlog.Info().Msgf("Reminder of session [%s] scheduled at %s", sessionID, at.Local().Format(timeFormatDisplay))
+		b.reminders.schedule(at, func() {
+			b.remind(sessionID, offset)
+		})
+	}
+}
+
+// remind posts a reminder that the session sessionID starts in offset,
+// unless it has started or changed in the meantime.
+func (b *Bot) remind(sessionID string, offset time.Duration) {
+	if b.ctx.Err() != nil || b.getSessionID() != sessionID ||
+		v1.SessionState(b.sessionState.Load()) != v1.SessionState_SESSION_STATE_WAITING {
+		return
+	}
+	err := b.sendToTopics(func(g *guild) *discordgo.MessageSend {
+		return &discordgo.MessageSend{Content: tr(g.locale, msgSessionReminder, int(offset.Minutes()))}
+	})
+	if err != nil {
+		zlog.Error().Msgf("Error sending reminder to topic: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/cockroachdb/errors"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	zlog "github.com/rs/zerolog/log"
+)
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// templateData is the data passed to message templates.
+type templateData struct {
+	Track   *v1.TrackInfo
+	Session *v1.SessionInfo
+	// Artists is Track.Artists joined with ", ".
+	Artists string
+	// Requester is a mention of the requester, or their name.
+	Requester string
+	// Keywords is Session.Keywords joined with ", ".
+	Keywords string
+	// EndTime is the localized scheduled end time of the session.
+	EndTime string
+	Locale  string
+}
+
+func newTemplateData(locale string, trackInfo *v1.TrackInfo, sessionInfo *v1.SessionInfo) *templateData {
+	data := &templateData{
+		Track:    trackInfo,
+		Session:  sessionInfo,
+		Keywords: strings.Join(sessionInfo.GetKeywords(), ", "),
+		EndTime:  formatSessionEnd(locale, sessionInfo.GetScheduledEndTime()),
+		Locale:   locale,
+	}
+	if trackInfo != nil {
+		data.Artists = strings.Join(trackInfo.Artists, ", ")
+		data.Requester = formatRequester(trackInfo)
+	}
+	return data
+}
+
+// messageTemplate overrides the parts of a built-in message it has a
+// template for.
+type messageTemplate struct {
+	content     *template.Template
+	title       *template.Template
+	description *template.Template
+	fields      []fieldTemplate
+}
+
+type fieldTemplate struct {
+	name   *template.Template
+	value  *template.Template
+	inline bool
+}
+
+// messageTemplates holds the parsed templates of TemplatesConfig. A nil
+// entry keeps the built-in message.
+type messageTemplates struct {
+	nowPlaying   *messageTemplate
+	sessionStart *messageTemplate
+	sessionEnd   *messageTemplate
+}
+
+func parseMessageTemplates(cfg TemplatesConfig) (*messageTemplates, error) {
+	var (
+		t   messageTemplates
+		err error
+	)
+	if t.nowPlaying, err = parseMessageTemplate("now_playing", cfg.NowPlaying); err != nil {
+		return nil, err
+	}
+	if t.sessionStart, err = parseMessageTemplate("session_start", cfg.SessionStart); err != nil {
+		return nil, err
+	}
+	if t.sessionEnd, err = parseMessageTemplate("session_end", cfg.SessionEnd); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func parseMessageTemplate(name string, cfg *MessageTemplate) (*messageTemplate, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	parse := func(part string, text string) (*template.Template, error) {
+		if text == "" {
+			return nil, nil
+		}
+		tmpl, err := template.New(name + "." + part).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing template %s.%s", name, part)
+		}
+		return tmpl, nil
+	}
+
+	var (
+		t   messageTemplate
+		err error
+	)
+	if t.content, err = parse("content", cfg.Content); err != nil {
+		return nil, err
+	}
+	if t.title, err = parse("title", cfg.Title); err != nil {
+		return nil, err
+	}
+	if t.description, err = parse("description", cfg.Description); err != nil {
+		return nil, err
+	}
+	for _, field := range cfg.Fields {
+		var f fieldTemplate
+		if f.name, err = parse("fields.name", field.Name); err != nil {
+			return nil, err
+		}
+		if f.value, err = parse("fields.value", field.Value); err != nil {
+			return nil, err
+		}
+		f.inline = field.Inline
+		t.fields = append(t.fields, f)
+	}
+	return &t, nil
+}
+
+// apply renders the template into msg. On error msg is left unchanged.
+func (t *messageTemplate) apply(msg *discordgo.MessageSend, data *templateData) *discordgo.MessageSend {
+	if t == nil {
+		return msg
+	}
+
+	var firstErr error
+	execute := func(tmpl *template.Template, fallback string) string {
+		if tmpl == nil || firstErr != nil {
+			return fallback
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			firstErr = err
+			return fallback
+		}
+		return buf.String()
+	}
+
+	rendered := *msg
+	embed := *msg.Embed
+	rendered.Embed = &embed
+	rendered.Content = execute(t.content, msg.Content)
+	embed.Title = execute(t.title, msg.Embed.Title)
+	embed.Description = execute(t.description, msg.Embed.Description)
+	if len(t.fields) > 0 {
+		embed.Fields = nil
+		for _, field := range t.fields {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:   execute(field.name, ""),
+				Value:  execute(field.value, ""),
+				Inline: field.inline,
+			})
+		}
+	}
+
+	if firstErr != nil {
+		zlog.Error().Msgf("Error executing message template: %v", firstErr)
+		return msg
+	}
+	return &rendered
+}
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	"github.com/osa030/19box-discordbot/internal/jukebox/jukeboxtest"
+)
+
+func builtinMessage() *discordgo.MessageSend {
+	return &discordgo.MessageSend{
+		Content: "built-in content",
+		Embed: &discordgo.MessageEmbed{
+			Title:       "built-in title",
+			Description: "built-in description",
+			Fields:      []*discordgo.MessageEmbedField{{Name: "built-in", Value: "field"}},
+		},
+	}
+}
+
+func testTemplateData() *templateData {
+	session := jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_RUNNING)
+	session.Keywords = []string{"city pop", "80s"}
+	track := jukeboxtest.Track("t1", v1.TrackState_TRACK_STATE_PLAYING)
+	track.Artists = []string{"a", "b"}
+	track.RequesterExternalUserId = "u1"
+	return newTemplateData(localeJa, track, session)
+}
+
+func TestMessageTemplate(t *testing.T) {
+	templates, err := parseMessageTemplates(TemplatesConfig{
+		NowPlaying: &MessageTemplate{
+			Content:     "{{ .Track.Name }} {{ .Requester }}",
+			Title:       "♪ {{ .Track.Name }}",
+			Description: "{{ .Artists }} / {{ join .Session.Keywords \" + \" }}",
+			Fields: []FieldTemplate{
+				{Name: "Session", Value: "{{ .Session.PlaylistName }}", Inline: true},
+				{Name: "Keywords", Value: "{{ .Keywords }}"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("parseMessageTemplates: %v", err)
+	}
+	msg := builtinMessage()
+	got := templates.nowPlaying.apply(msg, testTemplateData())
+
+	if got.Content != "track t1 selected by <@u1>" || got.Embed.Title != "♪ track t1" || got.Embed.Description != "a, b / city pop + 80s" {
+		t.Errorf("rendered = %q %q %q", got.Content, got.Embed.Title, got.Embed.Description)
+	}
+	want := []discordgo.MessageEmbedField{
+		{Name: "Session", Value: "playlist s1", Inline: true},
+		{Name: "Keywords", Value: "city pop, 80s"},
+	}
+	if len(got.Embed.Fields) != len(want) {
+		t.Fatalf("fields = %+v, want %+v", got.Embed.Fields, want)
+	}
+	for n, field := range got.Embed.Fields {
+		if *field != want[n] {
+			t.Errorf("field %d = %+v, want %+v", n, *field, want[n])
+		}
+	}
+	if msg.Content != "built-in content" || msg.Embed.Title != "built-in title" || len(msg.Embed.Fields) != 1 {
+		t.Errorf("built-in message changed: %+v", msg)
+	}
+}
+
+func TestMessageTemplateFallback(t *testing.T) {
+	templates, err := parseMessageTemplates(TemplatesConfig{
+		SessionStart: &MessageTemplate{Title: "{{ .Session.PlaylistName }} started"},
+	})
+	if err != nil {
+		t.Fatalf("parseMessageTemplates: %v", err)
+	}
+
+	// messages without a template are left alone
+	msg := builtinMessage()
+	if got := templates.nowPlaying.apply(msg, testTemplateData()); got != msg {
+		t.Errorf("apply without a template = %+v, want the built-in message", got)
+	}
+
+	// empty parts keep their built-in text, and the fields without a field template
+	got := templates.sessionStart.apply(builtinMessage(), testTemplateData())
+	if got.Embed.Title != "playlist s1 started" {
+		t.Errorf("title = %q", got.Embed.Title)
+	}
+	if got.Content != "built-in content" || got.Embed.Description != "built-in description" || len(got.Embed.Fields) != 1 || got.Embed.Fields[0].Name != "built-in" {
+		t.Errorf("rendered = %+v, want the other parts built in", got)
+	}
+}
+
+func TestMessageTemplateErrors(t *testing.T) {
+	_, err := parseMessageTemplates(TemplatesConfig{
+		SessionEnd: &MessageTemplate{Fields: []FieldTemplate{{Name: "ok", Value: "{{ .Session.PlaylistName"}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "session_end.fields.value") {
+		t.Errorf("parseMessageTemplates(unclosed action) = %v, want a parse error naming the template", err)
+	}
+	if _, err := parseMessageTemplates(TemplatesConfig{NowPlaying: &MessageTemplate{Title: "{{ nope }}"}}); err == nil {
+		t.Error("parseMessageTemplates(unknown function) = nil error")
+	}
+
+	templates, err := parseMessageTemplates(TemplatesConfig{
+		NowPlaying: &MessageTemplate{
+			Content: "fine",
+			Title:   "{{ .Track.Nope }}",
+		},
+		SessionEnd: &MessageTemplate{Title: "{{ .Track.Name }}"},
+	})
+	if err != nil {
+		t.Fatalf("parseMessageTemplates: %v", err)
+	}
+	// a template failing to execute leaves the whole message built in
+	msg := builtinMessage()
+	if got := templates.nowPlaying.apply(msg, testTemplateData()); got != msg || msg.Content != "built-in content" {
+		t.Errorf("apply(unknown field) = %+v, want the built-in message", got)
+	}
+	// session end messages have no track
+	msg = builtinMessage()
+	data := newTemplateData(localeJa, nil, jukeboxtest.Session("s1", v1.SessionState_SESSION_STATE_TERMINATED))
+	if got := templates.sessionEnd.apply(msg, data); got != msg {
+		t.Errorf("apply(nil track) = %+v, want the built-in message", got)
+	}
+}
@@ -2,28 +2,30 @@ package bot
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	"github.com/osa030/19box-discordbot/internal/spotify"
+	"github.com/osa030/19box-discordbot/internal/store"
 )
 
 const (
-	spotifyColor = 0x1DB954 // Spotifyの緑色
+	spotifyColor  = 0x1DB954 // Spotifyの緑色
+	rejectedColor = 0xED4245
 
-	// Message Templates
+	// Message Templates (locale independent; see messages.go for the rest)
 	msgSessionStartTitle = "🎵 session(%s)"
-	msgSessionStartBody  = "🔊 セッションを開始しました。\n\n🔚: %s\n"
-	msgSessionEndBody    = "🔊 セッションは終了しました。\n\n本日のプレイリストはコチラです。\n"
-	msgNowPlayingBody    = "🎙️ nowplaying「%s」%s\n\n%s\n"
 	msgRequesterUser     = "selected by <@%s>"
 	msgRequesterName     = "selected by %s"
-	msgInternalError     = "受付に失敗しました(内部エラー)"
-	msgTimeUndetermined  = "終了時間未定"
-	msgTimeScheduled     = "%s終了予定"
+	msgRemainingTime     = "%d:%02d"
 	msgActivityName      = "19box Discord Bot"
-	msgActivityState     = "🎵 Spotifyの曲を共有中"
+	msgRecapLine         = "`%02d` %s [%s](%s) / %s — %s\n"
+	msgRecapNoRequester  = "-"
+	msgProgress          = "%s %s / %s"
 
 	// Embed constants
 	embedPlaylistTitle = "🎶 %s"
@@ -31,12 +33,63 @@ const (
 	embedArtistPrefix  = "🎤 %s"
 	embedKeywordField  = "Keyword"
 
+	// recapPageSize is the number of tracks per recap message, which keeps
+	// a page well within the 4096 characters of an embed description.
+	recapPageSize = 15
+	// maxEmbedFieldLength is the limit of an embed field value.
+	maxEmbedFieldLength = 1024
+	// maxEmbedDescriptionLength is the limit of an embed description.
+	maxEmbedDescriptionLength = 4096
+
+	// /req-multi result lines
+	multiRequestAcceptedLine = "✅ %s"
+	multiRequestRejectedLine = "❌ %s: %s"
+	multiRequestErrorLine    = "⚠️ %s: %s"
+
+	progressBarWidth  = 12
+	progressBarFilled = "▰"
+	progressBarEmpty  = "▱"
+
 	// Time formats
 	timeFormatTopicTitle = "2006-01-02 15:04"
 	timeFormatDisplay    = "15:04"
 )
 
 var (
+	sessionStateLabels = map[v1.SessionState]string{
+		v1.SessionState_SESSION_STATE_WAITING:            msgStateWaiting,
+		v1.SessionState_SESSION_STATE_RUNNING:            msgStateRunning,
+		v1.SessionState_SESSION_STATE_PAUSED:             msgStatePaused,
+		v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS: msgStateWaitTracks,
+		v1.SessionState_SESSION_STATE_ENDING:             msgStateEnding,
+		v1.SessionState_SESSION_STATE_TERMINATED:         msgStateTerminated,
+	}
+
+	// sessionStateLines are the lines posted to the topic when the session
+	// moves to a state where nothing plays.
+	sessionStateLines = map[v1.SessionState]string{
+		v1.SessionState_SESSION_STATE_WAITING:            msgSessionWaitingLine,
+		v1.SessionState_SESSION_STATE_PAUSED:             msgSessionPausedLine,
+		v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS: msgSessionWaitingForTracksLine,
+		v1.SessionState_SESSION_STATE_ENDING:             msgSessionEndingLine,
+	}
+
+	trackStateLabels = map[v1.TrackState]string{
+		v1.TrackState_TRACK_STATE_STARTED: msgTrackPlaying,
+		v1.TrackState_TRACK_STATE_PLAYING: msgTrackPlaying,
+		v1.TrackState_TRACK_STATE_PAUSED:  msgTrackPaused,
+		v1.TrackState_TRACK_STATE_SKIPPED: msgTrackSkipped,
+	}
+
+	// requestResultMessages are the replies to requests by their result.
+	// Unknown codes get the message of the server.
+	requestResultMessages = map[jukebox.RequestCode]string{
+		jukebox.RequestCodeAccepted:          msgRequestQueued,
+		jukebox.RequestCodeUserPending:       msgRequestUserPending,
+		jukebox.RequestCodeKicked:            msgRequestKicked,
+		jukebox.RequestCodeMarketRestriction: msgRequestMarketRestriction,
+	}
+
 	spotifyFooter = &discordgo.MessageEmbedFooter{
 		Text:    "Spotify",
 		IconURL: "https://storage.googleapis.com/pr-newsroom-wp/1/2023/05/Spotify_Primary_Logo_RGB_Green.png",
@@ -45,15 +98,15 @@ var (
 
 // UI handling logic
 
-func formatSessionEnd(endTime string) string {
+func formatSessionEnd(locale string, endTime string) string {
 	if endTime == "" {
-		return msgTimeUndetermined
+		return tr(locale, msgTimeUndetermined)
 	}
 	t, err := time.Parse(time.RFC3339, endTime)
 	if err != nil {
-		return msgTimeUndetermined
+		return tr(locale, msgTimeUndetermined)
 	}
-	return fmt.Sprintf(msgTimeScheduled, t.Local().Format(timeFormatDisplay))
+	return tr(locale, msgTimeScheduled, t.Local().Format(timeFormatDisplay))
 }
 
 func createSessionMessage(content string, sessionInfo *v1.SessionInfo, thumbnailURL string) *discordgo.MessageSend {
@@ -74,16 +127,11 @@ func createSessionMessage(content string, sessionInfo *v1.SessionInfo, thumbnail
 	}
 }
 
-func createNowPlayingMessage(trackInfo *v1.TrackInfo, sessionInfo *v1.SessionInfo) *discordgo.MessageSend {
+func createNowPlayingMessage(locale string, trackInfo *v1.TrackInfo, sessionInfo *v1.SessionInfo) *discordgo.MessageSend {
 	artists := strings.Join(trackInfo.Artists, ", ")
-	var requester string
-	if trackInfo.RequesterExternalUserId != "" {
-		requester = fmt.Sprintf(msgRequesterUser, trackInfo.RequesterExternalUserId)
-	} else {
-		requester = fmt.Sprintf(msgRequesterName, trackInfo.RequesterName)
-	}
+	requester := formatRequester(trackInfo)
 
-	content := fmt.Sprintf(msgNowPlayingBody, trackInfo.Name, artists, requester)
+	content := tr(locale, msgNowPlayingBody, trackInfo.Name, artists, requester)
 	fields := createKeywordField(strings.Join(sessionInfo.Keywords, ", "))
 
 	return &discordgo.MessageSend{
@@ -102,6 +150,13 @@ func createNowPlayingMessage(trackInfo *v1.TrackInfo, sessionInfo *v1.SessionInf
 	}
 }
 
+func formatRequester(trackInfo *v1.TrackInfo) string {
+	if trackInfo.RequesterExternalUserId != "" {
+		return fmt.Sprintf(msgRequesterUser, trackInfo.RequesterExternalUserId)
+	}
+	return fmt.Sprintf(msgRequesterName, trackInfo.RequesterName)
+}
+
 func createKeywordField(keywords string) []*discordgo.MessageEmbedField {
 	if keywords == "" {
 		return nil
@@ -113,3 +168,230 @@ func createKeywordField(keywords string) []*discordgo.MessageEmbedField {
 		},
 	}
 }
+
+func formatSessionState(locale string, state v1.SessionState) string {
+	if label, ok := sessionStateLabels[state]; ok {
+		return tr(locale, label)
+	}
+	return tr(locale, msgStateUnspecified)
+}
+
+func formatRemaining(seconds int32) string {
+	return fmt.Sprintf(msgRemainingTime, seconds/60, seconds%60)
+}
+
+func formatAccepting(locale string, accepting bool) string {
+	if accepting {
+		return tr(locale, msgAccepting)
+	}
+	return tr(locale, msgNotAccepting)
+}
+
+// addNowPlayingProgress adds the state label and the progress of the track to
+// the live now playing message msg. An empty label adds no state.
+func addNowPlayingProgress(locale string, msg *discordgo.MessageSend, label string, elapsed int32, duration int32) *discordgo.MessageSend {
+	if msg.Embed == nil {
+		msg.Embed = &discordgo.MessageEmbed{Color: spotifyColor}
+	}
+	fields := []*discordgo.MessageEmbedField{
+		{Name: tr(locale, embedProgressField), Value: formatProgress(elapsed, duration)},
+	}
+	if label != "" {
+		fields = append([]*discordgo.MessageEmbedField{
+			{Name: tr(locale, embedStateField), Value: tr(locale, label), Inline: true},
+		}, fields...)
+	}
+	msg.Embed.Fields = append(msg.Embed.Fields, fields...)
+	return msg
+}
+
+func formatProgress(elapsed int32, duration int32) string {
+	filled := 0
+	if duration > 0 {
+		filled = int(min(max(elapsed, 0), duration) * progressBarWidth / duration)
+	}
+	bar := strings.Repeat(progressBarFilled, filled) + strings.Repeat(progressBarEmpty, progressBarWidth-filled)
+	return fmt.Sprintf(msgProgress, bar, formatRemaining(elapsed), formatRemaining(duration))
+}
+
+func createNowPlayingStatusMessage(locale string, status *v1.GetStatusResponse) *discordgo.MessageSend {
+	trackInfo := status.GetCurrentTrack()
+	msg := createNowPlayingMessage(locale, trackInfo, status.GetSessionInfo())
+	msg.Embed.Fields = append(msg.Embed.Fields, &discordgo.MessageEmbedField{
+		Name:   tr(locale, embedRemainField),
+		Value:  formatRemaining(trackInfo.RemainingSeconds),
+		Inline: true,
+	})
+	return msg
+}
+
+func createStatusMessage(locale string, status *v1.GetStatusResponse, thumbnailURL string) *discordgo.MessageSend {
+	sessionInfo := status.GetSessionInfo()
+	msg := createSessionMessage("", sessionInfo, thumbnailURL)
+
+	fields := []*discordgo.MessageEmbedField{
+		{Name: tr(locale, embedStateField), Value: formatSessionState(locale, sessionInfo.State), Inline: true},
+		{Name: tr(locale, embedEndTimeField), Value: formatSessionEnd(locale, sessionInfo.ScheduledEndTime), Inline: true},
+		{Name: tr(locale, embedAcceptField), Value: formatAccepting(locale, sessionInfo.AcceptingRequests), Inline: true},
+		{Name: tr(locale, embedQueueField), Value: tr(locale, msgQueueSize, status.QueueSize), Inline: true},
+		{Name: tr(locale, embedListenerField), Value: tr(locale, msgListenerCount, status.ListenerCount), Inline: true},
+	}
+	if trackInfo := status.GetCurrentTrack(); trackInfo != nil {
+		fields = append(fields,
+			&discordgo.MessageEmbedField{
+				Name:  fmt.Sprintf(embedTrackTitle, trackInfo.Name),
+				Value: fmt.Sprintf(embedArtistPrefix, strings.Join(trackInfo.Artists, ", ")),
+			},
+			&discordgo.MessageEmbedField{
+				Name:   tr(locale, embedRemainField),
+				Value:  formatRemaining(trackInfo.RemainingSeconds),
+				Inline: true,
+			},
+		)
+	}
+	msg.Embed.Fields = append(msg.Embed.Fields, fields...)
+	return msg
+}
+
+// recapPages returns the number of recap messages for tracks tracks.
+func recapPages(tracks int) int {
+	return (tracks + recapPageSize - 1) / recapPageSize
+}
+
+// createRecapMessage returns page (0-based) of the set list of tracks. The
+// last page also carries the number of tracks each requester got played.
+func createRecapMessage(locale string, tracks []store.PlayedTrack, page int) *discordgo.MessageSend {
+	pages := recapPages(len(tracks))
+	start := page * recapPageSize
+	end := min(start+recapPageSize, len(tracks))
+
+	var description strings.Builder
+	for n, track := range tracks[start:end] {
+		fmt.Fprintf(&description, msgRecapLine,
+			start+n+1,
+			track.StartedAt.Local().Format(timeFormatDisplay),
+			track.Name,
+			track.URL,
+			strings.Join(track.Artists, ", "),
+			formatPlayedRequester(track),
+		)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       tr(locale, embedRecapTitle, page+1, pages),
+		Description: description.String(),
+		Color:       spotifyColor,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: tr(locale, msgRecapTrackCount, len(tracks)),
+		},
+	}
+	if page == pages-1 {
+		if field := createRequestCountField(locale, tracks); field != nil {
+			embed.Fields = append(embed.Fields, field)
+		}
+	}
+	return &discordgo.MessageSend{Embed: embed}
+}
+
+func formatPlayedRequester(track store.PlayedTrack) string {
+	switch {
+	case track.RequesterUserID != "":
+		return fmt.Sprintf("<@%s>", track.RequesterUserID)
+	case track.RequesterName != "":
+		return track.RequesterName
+	}
+	return msgRecapNoRequester
+}
+
+// createRequestCountField lists the requesters of tracks by the number of
+// their tracks, most first. It returns nil when no track had a requester.
+func createRequestCountField(locale string, tracks []store.PlayedTrack) *discordgo.MessageEmbedField {
+	var requesters []string
+	counts := map[string]int{}
+	for _, track := range tracks {
+		requester := formatPlayedRequester(track)
+		if requester == msgRecapNoRequester {
+			continue
+		}
+		if counts[requester] == 0 {
+			requesters = append(requesters, requester)
+		}
+		counts[requester]++
+	}
+	if len(requesters) == 0 {
+		return nil
+	}
+	// stable, so that ties keep the order of the first request
+	slices.SortStableFunc(requesters, func(a, b string) int {
+		return counts[b] - counts[a]
+	})
+
+	var value strings.Builder
+	for _, requester := range requesters {
+		value.WriteString(tr(locale, msgRecapRequestCountLine, requester, counts[requester]))
+	}
+	return &discordgo.MessageEmbedField{
+		Name:  tr(locale, embedRecapRequestsField),
+		Value: truncate(value.String(), maxEmbedFieldLength),
+	}
+}
+
+// createRequestResultMessage builds the reply to /req: the result of the
+// request with a preview of track. A track whose name could not be looked up
+// is linked in the content instead, so that Discord unfurls it.
+func createRequestResultMessage(locale string, result jukebox.RequestResult, track batchTrack) *discordgo.MessageSend {
+	url := spotify.Link{Kind: spotify.KindTrack, ID: track.ID}.URL()
+	embed := &discordgo.MessageEmbed{
+		Title:       tr(locale, msgRequestAccepted),
+		Description: formatRequestResult(locale, result),
+		URL:         url,
+		Color:       spotifyColor,
+		Footer:      spotifyFooter,
+	}
+	if !result.Success {
+		embed.Title = tr(locale, msgRequestRejected)
+		embed.Color = rejectedColor
+	}
+	if track.Name == "" {
+		return &discordgo.MessageSend{Content: url, Embed: embed}
+	}
+
+	// Discord requires a field value, and tracks looked up with oEmbed have
+	// no artists
+	field := &discordgo.MessageEmbedField{Name: fmt.Sprintf(embedTrackTitle, track.Name), Value: url}
+	if len(track.Artists) > 0 {
+		field.Value = fmt.Sprintf(embedArtistPrefix, strings.Join(track.Artists, ", "))
+	}
+	embed.Fields = []*discordgo.MessageEmbedField{field}
+	if track.AlbumArtURL != "" {
+		embed.Thumbnail = &discordgo.MessageEmbedThumbnail{URL: track.AlbumArtURL}
+	}
+	return &discordgo.MessageSend{Embed: embed}
+}
+
+// formatRequestResult returns the message for result, falling back to the
+// message of the server for codes without one.
+func formatRequestResult(locale string, result jukebox.RequestResult) string {
+	if id, ok := requestResultMessages[result.Code]; ok {
+		return tr(locale, id)
+	}
+	return result.Message
+}
+
+// createMultiRequestMessage builds the reply to /req-multi: how many of the
+// tracks were accepted, with a line for each track and each unusable link.
+func createMultiRequestMessage(locale string, accepted int, total int, lines []string) *discordgo.MessageSend {
+	embed := &discordgo.MessageEmbed{
+		Title:       tr(locale, msgMultiRequestTitle, accepted, total),
+		Description: truncate(strings.Join(lines, "\n"), maxEmbedDescriptionLength),
+		Color:       spotifyColor,
+		Footer:      spotifyFooter,
+	}
+	if total == 0 {
+		embed.Title = tr(locale, msgMultiRequestNoTracks)
+	}
+	if accepted == 0 {
+		embed.Color = rejectedColor
+	}
+	return &discordgo.MessageSend{Embed: embed}
+}
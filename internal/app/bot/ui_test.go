@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	jukebox "github.com/osa030/19box-discordbot/internal/jukebox"
+	"github.com/osa030/19box-discordbot/internal/store"
+)
+
+func TestCreateRecapMessage(t *testing.T) {
+	requesters := []string{"", "u1", "u2", "u2"}
+	var tracks []store.PlayedTrack
+	for n := range 20 {
+		tracks = append(tracks, store.PlayedTrack{
+			TrackID:         fmt.Sprint(n),
+			Name:            fmt.Sprintf("track %d", n+1),
+			URL:             fmt.Sprintf("https://open.spotify.com/track/%d", n+1),
+			Artists:         []string{"artist"},
+			RequesterUserID: requesters[n%len(requesters)],
+			StartedAt:       time.Date(2025, 1, 1, 20, n, 0, 0, time.Local),
+		})
+	}
+
+	if got := recapPages(len(tracks)); got != 2 {
+		t.Fatalf("pages = %d, want 2", got)
+	}
+	first := createRecapMessage(localeEn, tracks, 0).Embed
+	last := createRecapMessage(localeEn, tracks, 1).Embed
+
+	if first.Title != "📜 Set list (1/2)" || last.Title != "📜 Set list (2/2)" {
+		t.Errorf("titles = %q, %q", first.Title, last.Title)
+	}
+	if got := strings.Count(first.Description, "\n"); got != recapPageSize {
+		t.Errorf("first page lines = %d, want %d", got, recapPageSize)
+	}
+	if want := "`16` 20:15 [track 16](https://open.spotify.com/track/16) / artist — <@u2>\n"; !strings.HasPrefix(last.Description, want) {
+		t.Errorf("last page = %q, want it to start with %q", last.Description, want)
+	}
+	if want := "`01` 20:00 [track 1](https://open.spotify.com/track/1) / artist — -\n"; !strings.HasPrefix(first.Description, want) {
+		t.Errorf("first page = %q, want it to start with %q", first.Description, want)
+	}
+	if first.Footer.Text != "20 tracks" {
+		t.Errorf("footer = %q", first.Footer.Text)
+	}
+
+	if len(first.Fields) != 0 {
+		t.Errorf("first page fields = %v, want none", first.Fields)
+	}
+	if len(last.Fields) != 1 || last.Fields[0].Value != "<@u2>: 10\n<@u1>: 5\n" {
+		t.Errorf("request counts = %+v", last.Fields)
+	}
+}
+
+func TestCreateRequestResultMessage(t *testing.T) {
+	const trackID = "4uLU6hMCjMI75M1A2tKUQC"
+	url := "https://open.spotify.com/track/" + trackID
+
+	accepted := jukebox.RequestResult{Success: true, Code: jukebox.RequestCodeAccepted, Message: "queued"}
+	msg := createRequestResultMessage(localeEn, accepted, batchTrack{ID: trackID})
+	if msg.Content != url || msg.Embed.Title != "✅ Request accepted" || msg.Embed.Description != "Added to the queue. Stay tuned!" || msg.Embed.URL != url {
+		t.Errorf("unknown track = %q %q %q %q", msg.Content, msg.Embed.Title, msg.Embed.Description, msg.Embed.URL)
+	}
+	if msg.Embed.Fields != nil || msg.Embed.Thumbnail != nil {
+		t.Errorf("unknown track previewed: %+v %+v", msg.Embed.Fields, msg.Embed.Thumbnail)
+	}
+
+	known := batchTrack{
+		ID:          trackID,
+		Name:        "Never Gonna Give You Up",
+		Artists:     []string{"Rick Astley"},
+		AlbumArtURL: "https://i.scdn.co/image/art",
+	}
+	rejected := jukebox.RequestResult{Code: jukebox.RequestCodeUnknown, RawCode: "cosmic_rays", Message: "bit flipped"}
+	msg = createRequestResultMessage(localeEn, rejected, known)
+	if msg.Content != "" || msg.Embed.Title != "⚠️ Request not accepted" || msg.Embed.Color != rejectedColor {
+		t.Errorf("known track = %q %q %x", msg.Content, msg.Embed.Title, msg.Embed.Color)
+	}
+	if msg.Embed.Description != "bit flipped" {
+		t.Errorf("unknown code description = %q, want the server message", msg.Embed.Description)
+	}
+	if len(msg.Embed.Fields) != 1 || msg.Embed.Fields[0].Name != "🎵 Never Gonna Give You Up" || msg.Embed.Fields[0].Value != "🎤 Rick Astley" {
+		t.Errorf("known track fields = %+v", msg.Embed.Fields)
+	}
+	if msg.Embed.Thumbnail == nil || msg.Embed.Thumbnail.URL != known.AlbumArtURL {
+		t.Errorf("known track thumbnail = %+v", msg.Embed.Thumbnail)
+	}
+
+	// tracks looked up with oEmbed have no artists
+	msg = createRequestResultMessage(localeEn, accepted, batchTrack{ID: trackID, Name: "Never Gonna Give You Up"})
+	if len(msg.Embed.Fields) != 1 || msg.Embed.Fields[0].Value != url || msg.Embed.Thumbnail != nil {
+		t.Errorf("track without artists = %+v %+v, want its link as the field value", msg.Embed.Fields, msg.Embed.Thumbnail)
+	}
+}
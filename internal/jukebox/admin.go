@@ -0,0 +1,82 @@
+package jukebox
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"github.com/cockroachdb/errors"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	zlog "github.com/rs/zerolog/log"
+)
+
+func (c *Client) GetStatus(ctx context.Context) (*v1.GetStatusResponse, error) {
+	getStatusResponse, err := c.admin.GetStatus(ctx, connect.NewRequest(&v1.GetStatusRequest{}))
+	if err != nil {
+		zlog.Error().Msgf("Error 19box get status: %v", err)
+		return nil, errors.Wrap(err, "error 19box get status")
+	}
+	zlog.Debug().Msgf("19box get status: session(%v) queue(%d) listeners(%d)", getStatusResponse.Msg.GetSessionInfo().GetState(), getStatusResponse.Msg.QueueSize, getStatusResponse.Msg.ListenerCount)
+	return getStatusResponse.Msg, nil
+}
+
+func (c *Client) Pause(ctx context.Context) (bool, string, error) {
+	pauseResponse, err := c.admin.Pause(ctx, connect.NewRequest(&v1.PauseRequest{}))
+	if err != nil {
+		zlog.Error().Msgf("Error 19box pause: %v", err)
+		return false, "", errors.Wrap(err, "error 19box pause")
+	}
+	zlog.Debug().Msgf("19box pause result: %v[%s]", pauseResponse.Msg.Success, pauseResponse.Msg.Message)
+	return pauseResponse.Msg.Success, pauseResponse.Msg.Message, nil
+}
+
+func (c *Client) Resume(ctx context.Context) (bool, string, error) {
+	resumeResponse, err := c.admin.Resume(ctx, connect.NewRequest(&v1.ResumeRequest{}))
+	if err != nil {
+		zlog.Error().Msgf("Error 19box resume: %v", err)
+		return false, "", errors.Wrap(err, "error 19box resume")
+	}
+	zlog.Debug().Msgf("19box resume result: %v[%s]", resumeResponse.Msg.Success, resumeResponse.Msg.Message)
+	return resumeResponse.Msg.Success, resumeResponse.Msg.Message, nil
+}
+
+func (c *Client) Skip(ctx context.Context) (bool, string, error) {
+	skipResponse, err := c.admin.Skip(ctx, connect.NewRequest(&v1.SkipRequest{}))
+	if err != nil {
+		zlog.Error().Msgf("Error 19box skip: %v", err)
+		return false, "", errors.Wrap(err, "error 19box skip")
+	}
+	zlog.Debug().Msgf("19box skip result: %v[%s]", skipResponse.Msg.Success, skipResponse.Msg.Message)
+	return skipResponse.Msg.Success, skipResponse.Msg.Message, nil
+}
+
+func (c *Client) Kick(ctx context.Context, listenerId string) (bool, string, error) {
+	kickResponse, err := c.admin.Kick(ctx, connect.NewRequest(&v1.KickRequest{
+		ListenerId: listenerId,
+	}))
+	if err != nil {
+		zlog.Error().Msgf("Error 19box kick: %v", err)
+		return false, "", errors.Wrap(err, "error 19box kick")
+	}
+	zlog.Debug().Msgf("19box kick result: %s %v[%s]", listenerId, kickResponse.Msg.Success, kickResponse.Msg.Message)
+	return kickResponse.Msg.Success, kickResponse.Msg.Message, nil
+}
+
+func (c *Client) ListListeners(ctx context.Context) ([]*v1.ListenerInfo, error) {
+	listListenersResponse, err := c.admin.ListListeners(ctx, connect.NewRequest(&v1.ListListenersRequest{}))
+	if err != nil {
+		zlog.Error().Msgf("Error 19box list listeners: %v", err)
+		return nil, errors.Wrap(err, "error 19box list listeners")
+	}
+	zlog.Debug().Msgf("19box list listeners: %d", len(listListenersResponse.Msg.Listeners))
+	return listListenersResponse.Msg.Listeners, nil
+}
+
+func (c *Client) StopSession(ctx context.Context) (bool, string, error) {
+	stopSessionResponse, err := c.admin.StopSession(ctx, connect.NewRequest(&v1.StopSessionRequest{}))
+	if err != nil {
+		zlog.Error().Msgf("Error 19box stop session: %v", err)
+		return false, "", errors.Wrap(err, "error 19box stop session")
+	}
+	zlog.Debug().Msgf("19box stop session result: %v[%s]", stopSessionResponse.Msg.Success, stopSessionResponse.Msg.Message)
+	return stopSessionResponse.Msg.Success, stopSessionResponse.Msg.Message, nil
+}
@@ -2,8 +2,10 @@ package jukebox
 
 import (
 	"context"
+	"math/rand/v2"
 	"net/http"
 	"sync"
+	"time"
 
 	"connectrpc.com/connect"
 	"github.com/cockroachdb/errors"
@@ -12,6 +14,14 @@ import (
 	zlog "github.com/rs/zerolog/log"
 )
 
+const (
+	reconnectBackoffMin = 1 * time.Second
+	reconnectBackoffMax = 30 * time.Second
+	resyncTimeout       = 10 * time.Second
+)
+
+var errStreamClosed = errors.New("stream closed")
+
 type NotificationType int
 
 const (
@@ -20,25 +30,71 @@ const (
 	NotificationTypeTrackStart
 	NotificationTypeStreamClosed
 	NotificationTypeStreamError
+	NotificationTypeStreamReconnecting
+	NotificationTypeSequenceGap
+	// NotificationTypeTrackUpdate reports that the current track was
+	// resumed, paused or skipped; see Track.State.
+	NotificationTypeTrackUpdate
+	// NotificationTypeSessionPaused reports that playback was paused.
+	NotificationTypeSessionPaused
+	// NotificationTypeSessionWaitingForTracks reports that the queue ran out
+	// and the session waits for requests.
+	NotificationTypeSessionWaitingForTracks
+	// NotificationTypeSessionEnding reports that the session stopped taking
+	// requests and plays out the queue.
+	NotificationTypeSessionEnding
+	// NotificationTypeSessionWaiting reports a session that has not started
+	// yet.
+	NotificationTypeSessionWaiting
 )
 
+// sessionStateNotifications maps session states to the notification of a
+// transition to them.
+var sessionStateNotifications = map[v1.SessionState]NotificationType{
+	v1.SessionState_SESSION_STATE_WAITING:            NotificationTypeSessionWaiting,
+	v1.SessionState_SESSION_STATE_RUNNING:            NotificationTypeSessionStart,
+	v1.SessionState_SESSION_STATE_PAUSED:             NotificationTypeSessionPaused,
+	v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS: NotificationTypeSessionWaitingForTracks,
+	v1.SessionState_SESSION_STATE_ENDING:             NotificationTypeSessionEnding,
+	v1.SessionState_SESSION_STATE_TERMINATED:         NotificationTypeSessionEnd,
+}
+
 type Notification struct {
-	Type    NotificationType
-	Session *v1.SessionInfo
-	Track   *v1.TrackInfo
-	Error   error
+	Type       NotificationType
+	SequenceNo uint64
+	Session    *v1.SessionInfo
+	Track      *v1.TrackInfo
+	Error      error
 }
+
+type notificationStream = connect.ServerStreamForClient[v1.Notification]
+
 type Client struct {
-	client        jukeboxv1connect.ListenerServiceClient
-	stream        *connect.ServerStreamForClient[v1.Notification]
-	notifications chan *Notification
-	closeOnce     sync.Once
+	client           jukeboxv1connect.ListenerServiceClient
+	admin            jukeboxv1connect.AdminServiceClient
+	notifications    chan *Notification
+	reconnectTimeout time.Duration
+	backoffMin       time.Duration
+	backoffMax       time.Duration
+	lastSession      *v1.SessionInfo // owned by the receiving goroutine
+	lastSequenceNo   uint64          // owned by the receiving goroutine
+	cancel           context.CancelFunc
+	wg               sync.WaitGroup
+	closeOnce        sync.Once
 }
 
-func NewClient(url string) *Client {
+// NewClient creates a client for the 19box server at url.
+// When the notification stream is lost the client re-subscribes with
+// exponential backoff for up to reconnectTimeout before reporting
+// NotificationTypeStreamError. A zero reconnectTimeout disables reconnection.
+func NewClient(url string, reconnectTimeout time.Duration) *Client {
 	return &Client{
-		client:        jukeboxv1connect.NewListenerServiceClient(http.DefaultClient, url),
-		notifications: make(chan *Notification, 10),
+		client:           jukeboxv1connect.NewListenerServiceClient(http.DefaultClient, url),
+		admin:            jukeboxv1connect.NewAdminServiceClient(http.DefaultClient, url),
+		notifications:    make(chan *Notification, 10),
+		reconnectTimeout: reconnectTimeout,
+		backoffMin:       reconnectBackoffMin,
+		backoffMax:       reconnectBackoffMax,
 	}
 }
 
@@ -56,81 +112,249 @@ func (c *Client) Join(ctx context.Context, displayName string, externalUserId st
 	return listenerId, nil
 }
 
-func (c *Client) Request(ctx context.Context, listenerId string, trackId string) (bool, string, string, error) {
+// Request requests trackId on behalf of the listener listenerId. A request
+// rejected by the server is not an error; see RequestResult.Code.
+func (c *Client) Request(ctx context.Context, listenerId string, trackId string) (RequestResult, error) {
 	requestTrackResponse, err := c.client.RequestTrack(ctx, connect.NewRequest(&v1.RequestTrackRequest{
 		ListenerId: listenerId,
 		TrackId:    trackId,
 	}))
 	if err != nil {
 		zlog.Error().Msgf("Error 19box request track: %v", err)
-		return false, "", "", errors.Wrap(err, "error 19box request")
+		return RequestResult{}, errors.Wrap(err, "error 19box request")
 	}
-	zlog.Debug().Msgf("19box request track result: %s(%s)[%s](%s)", listenerId, trackId, requestTrackResponse.Msg.Message, requestTrackResponse.Msg.Code)
-	return requestTrackResponse.Msg.Success, requestTrackResponse.Msg.Message, requestTrackResponse.Msg.Code, nil
+	msg := requestTrackResponse.Msg
+	zlog.Debug().Msgf("19box request track result: %s(%s)[%s](%s)", listenerId, trackId, msg.Message, msg.Code)
+	return newRequestResult(msg.Success, msg.Code, msg.Message), nil
+}
+
+// Subscribe starts receiving notifications until Unsubscribe is called.
+// A server that cannot be reached yet is retried like a lost stream, so
+// failures are reported on the notification channel.
+func (c *Client) Subscribe(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	stream, err := c.subscribe(ctx)
+	c.wg.Add(1)
+	go c.run(ctx, stream, err)
 }
 
-func (c *Client) Subscribe(ctx context.Context) error {
+func (c *Client) subscribe(ctx context.Context) (*notificationStream, error) {
 	stream, err := c.client.SubscribeNotifications(ctx, connect.NewRequest(&v1.SubscribeNotificationsRequest{}))
 	if err != nil {
 		zlog.Error().Msgf("Error 19box subscribe notifications: %v", err)
-		return errors.Wrap(err, "error 19box subscribe notifications")
-	}
-	c.stream = stream
-	go func() {
-		zlog.Info().Msg("Receiving notifications...")
-		defer zlog.Info().Msg("Stopped receiving notifications")
-
-		for c.stream.Receive() {
-			jukeboxNotification := c.stream.Msg()
-			notificationType := jukeboxNotification.GetType()
-			sessionState := jukeboxNotification.GetSessionInfo().GetState()
-			trackState := jukeboxNotification.GetTrackInfo().GetState()
-			zlog.Info().Msgf("Received seqNo:[%d] notification(%v) session state(%v), track state(%v)", jukeboxNotification.GetSequenceNo(), notificationType, sessionState, trackState)
-
-			notification := &Notification{
-				Session: jukeboxNotification.GetSessionInfo(),
-				Track:   jukeboxNotification.GetTrackInfo(),
-			}
+		return nil, errors.Wrap(err, "error 19box subscribe notifications")
+	}
+	return stream, nil
+}
+
+// run receives notifications until ctx is canceled, re-subscribing whenever
+// the stream is lost. A nil stream is one that failed to subscribe with err.
+// The give-up window starts when the stream is lost and is reset as soon as a
+// notification is received on a new stream.
+func (c *Client) run(ctx context.Context, stream *notificationStream, err error) {
+	defer c.wg.Done()
+	zlog.Info().Msg("Receiving notifications...")
+	defer zlog.Info().Msg("Stopped receiving notifications")
 
-			switch notificationType {
-			case v1.NotificationType_NOTIFICATION_TYPE_INITIAL_STATE, v1.NotificationType_NOTIFICATION_TYPE_CHANGE_STATE:
-				if sessionState == v1.SessionState_SESSION_STATE_RUNNING {
-					notification.Type = NotificationTypeSessionStart
-					c.notifications <- notification
-					continue
-				}
-
-				if sessionState == v1.SessionState_SESSION_STATE_TERMINATED {
-					notification.Type = NotificationTypeSessionEnd
-					c.notifications <- notification
-					continue
-				}
-
-			case v1.NotificationType_NOTIFICATION_TYPE_CHANGE_TRACK:
-				if trackState == v1.TrackState_TRACK_STATE_STARTED {
-					notification.Type = NotificationTypeTrackStart
-					c.notifications <- notification
-					continue
-				}
+	var (
+		lostAt  time.Time
+		resumed bool
+		backoff = c.backoffMin
+	)
+	for {
+		if stream != nil {
+			var received bool
+			received, err = c.receive(ctx, stream, resumed)
+			if received {
+				lostAt = time.Time{}
+				backoff = c.backoffMin
 			}
 		}
+		if ctx.Err() != nil {
+			return
+		}
 
-		if err := c.stream.Err(); err != nil {
-			zlog.Error().Msgf("Error receiving notification: %v", err)
-			c.notifications <- &Notification{
+		if c.reconnectTimeout <= 0 {
+			c.sendStreamEnd(ctx, err)
+			return
+		}
+		if lostAt.IsZero() {
+			lostAt = time.Now()
+			zlog.Warn().Msgf("Notification stream lost: %v", err)
+			c.send(ctx, &Notification{
+				Type:  NotificationTypeStreamReconnecting,
+				Error: err,
+			})
+		}
+		if time.Since(lostAt) >= c.reconnectTimeout {
+			zlog.Error().Msgf("Giving up reconnecting after %v: %v", c.reconnectTimeout, err)
+			c.send(ctx, &Notification{
 				Type:  NotificationTypeStreamError,
-				Error: errors.Wrap(err, "error receiving notification"),
-			}
+				Error: errors.Wrapf(err, "gave up reconnecting after %v", c.reconnectTimeout),
+			})
 			return
 		}
 
-		c.notifications <- &Notification{
-			Type:  NotificationTypeStreamClosed,
-			Error: errors.New("stream closed"),
+		wait := withJitter(backoff)
+		backoff = min(backoff*2, c.backoffMax)
+		zlog.Info().Msgf("Reconnecting notification stream in %v...", wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		stream, err = c.subscribe(ctx)
+		resumed = true
+	}
+}
+
+// receive consumes stream until it ends and reports whether any notification
+// was received. The returned error is never nil.
+func (c *Client) receive(ctx context.Context, stream *notificationStream, resumed bool) (bool, error) {
+	defer func() { _ = stream.Close() }()
+
+	received := false
+	for stream.Receive() {
+		received = true
+		c.dispatch(ctx, stream.Msg(), resumed)
+	}
+	if err := stream.Err(); err != nil {
+		zlog.Error().Msgf("Error receiving notification: %v", err)
+		return received, errors.Wrap(err, "error receiving notification")
+	}
+	return received, errStreamClosed
+}
+
+func (c *Client) dispatch(ctx context.Context, jukeboxNotification *v1.Notification, resumed bool) {
+	notificationType := jukeboxNotification.GetType()
+	sessionState := jukeboxNotification.GetSessionInfo().GetState()
+	trackState := jukeboxNotification.GetTrackInfo().GetState()
+	zlog.Info().Msgf("Received seqNo:[%d] notification(%v) session state(%v), track state(%v)", jukeboxNotification.GetSequenceNo(), notificationType, sessionState, trackState)
+
+	sequenceNo := jukeboxNotification.GetSequenceNo()
+	if notificationType != v1.NotificationType_NOTIFICATION_TYPE_INITIAL_STATE {
+		c.checkSequence(ctx, sequenceNo)
+	}
+	c.lastSequenceNo = sequenceNo
+
+	sessionInfo := jukeboxNotification.GetSessionInfo()
+	if sessionInfo != nil {
+		defer func() { c.lastSession = sessionInfo }()
+	}
+
+	notification := &Notification{
+		SequenceNo: sequenceNo,
+		Session:    sessionInfo,
+		Track:      jukeboxNotification.GetTrackInfo(),
+	}
+
+	switch notificationType {
+	case v1.NotificationType_NOTIFICATION_TYPE_INITIAL_STATE, v1.NotificationType_NOTIFICATION_TYPE_CHANGE_STATE:
+		if resumed && notificationType == v1.NotificationType_NOTIFICATION_TYPE_INITIAL_STATE {
+			c.reconcile(ctx, sessionInfo)
+		}
+
+		if notificationType, ok := sessionStateNotifications[sessionState]; ok {
+			notification.Type = notificationType
+			c.send(ctx, notification)
+			return
+		}
+
+	case v1.NotificationType_NOTIFICATION_TYPE_CHANGE_TRACK:
+		switch trackState {
+		case v1.TrackState_TRACK_STATE_STARTED:
+			notification.Type = NotificationTypeTrackStart
+			c.send(ctx, notification)
+		case v1.TrackState_TRACK_STATE_PLAYING,
+			v1.TrackState_TRACK_STATE_PAUSED,
+			v1.TrackState_TRACK_STATE_SKIPPED:
+			notification.Type = NotificationTypeTrackUpdate
+			c.send(ctx, notification)
 		}
+	}
+}
 
-	}()
-	return nil
+// reconcile compares the initial state of a resumed stream with the last
+// session seen before the disconnect, and ends that session if the server
+// has moved on to another one in the meantime.
+func (c *Client) reconcile(ctx context.Context, sessionInfo *v1.SessionInfo) {
+	last := c.lastSession
+	if last == nil || last.GetState() == v1.SessionState_SESSION_STATE_TERMINATED {
+		return
+	}
+	if sessionInfo.GetSessionId() == last.GetSessionId() &&
+		(sessionInfo.GetState() != v1.SessionState_SESSION_STATE_WAITING || last.GetState() == v1.SessionState_SESSION_STATE_WAITING) {
+		return
+	}
+	zlog.Info().Msgf("Session [%s] ended while disconnected", last.GetSessionId())
+	c.send(ctx, &Notification{
+		Type:    NotificationTypeSessionEnd,
+		Session: last,
+	})
+}
+
+// checkSequence compares sequenceNo with the last one received on the stream.
+// On a gap or a regression (server restart) it fetches the full state from
+// the server and sends it as NotificationTypeSequenceGap, so the bot can
+// catch up on whatever it missed.
+func (c *Client) checkSequence(ctx context.Context, sequenceNo uint64) {
+	last := c.lastSequenceNo
+	if last == 0 || sequenceNo == last+1 {
+		return
+	}
+
+	var gapErr error
+	if sequenceNo <= last {
+		gapErr = errors.Newf("sequence regressed from %d to %d", last, sequenceNo)
+	} else {
+		gapErr = errors.Newf("missed %d notification(s) between %d and %d", sequenceNo-last-1, last, sequenceNo)
+	}
+	zlog.Warn().Msgf("Notification sequence gap: %v", gapErr)
+
+	resyncCtx, cancel := context.WithTimeout(ctx, resyncTimeout)
+	defer cancel()
+	status, err := c.GetStatus(resyncCtx)
+	if err != nil {
+		zlog.Error().Msgf("Error resyncing state: %v", err)
+		return
+	}
+	if status.GetSessionInfo() != nil {
+		c.lastSession = status.GetSessionInfo()
+	}
+	c.send(ctx, &Notification{
+		Type:       NotificationTypeSequenceGap,
+		SequenceNo: sequenceNo,
+		Session:    status.GetSessionInfo(),
+		Track:      status.GetCurrentTrack(),
+		Error:      gapErr,
+	})
+}
+
+func (c *Client) sendStreamEnd(ctx context.Context, err error) {
+	if errors.Is(err, errStreamClosed) {
+		c.send(ctx, &Notification{
+			Type:  NotificationTypeStreamClosed,
+			Error: err,
+		})
+		return
+	}
+	c.send(ctx, &Notification{
+		Type:  NotificationTypeStreamError,
+		Error: err,
+	})
+}
+
+func (c *Client) send(ctx context.Context, notification *Notification) {
+	select {
+	case c.notifications <- notification:
+	case <-ctx.Done():
+	}
+}
+
+// withJitter returns d randomized by up to ±25%.
+func withJitter(d time.Duration) time.Duration {
+	return d*3/4 + rand.N(d/2+1)
 }
 
 func (c *Client) ReceiveNotifications() <-chan *Notification {
@@ -139,13 +363,10 @@ func (c *Client) ReceiveNotifications() <-chan *Notification {
 
 func (c *Client) Unsubscribe() {
 	c.closeOnce.Do(func() {
-		if c.stream != nil {
-			_ = c.stream.Close()
-			c.stream = nil
-		}
-		if c.notifications != nil {
-			close(c.notifications)
-			c.notifications = nil
+		if c.cancel != nil {
+			c.cancel()
 		}
+		c.wg.Wait()
+		close(c.notifications)
 	})
 }
@@ -0,0 +1,316 @@
+package jukebox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/cockroachdb/errors"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	"github.com/osa030/19box-discordbot/internal/jukebox/jukeboxtest"
+)
+
+const (
+	waiting    = v1.SessionState_SESSION_STATE_WAITING
+	running    = v1.SessionState_SESSION_STATE_RUNNING
+	terminated = v1.SessionState_SESSION_STATE_TERMINATED
+	started    = v1.TrackState_TRACK_STATE_STARTED
+	playing    = v1.TrackState_TRACK_STATE_PLAYING
+)
+
+func newTestClient(t *testing.T, server *jukeboxtest.Server, reconnectTimeout time.Duration) *Client {
+	t.Helper()
+	c := NewClient(server.URL, reconnectTimeout)
+	c.backoffMin = 10 * time.Millisecond
+	c.backoffMax = 50 * time.Millisecond
+	c.Subscribe(context.Background())
+	t.Cleanup(c.Unsubscribe)
+	return c
+}
+
+// expect receives the next notification and checks its type.
+func expect(t *testing.T, c *Client, want NotificationType) *Notification {
+	t.Helper()
+	select {
+	case n, ok := <-c.ReceiveNotifications():
+		if !ok {
+			t.Fatalf("notifications closed, want %v", want)
+		}
+		if n.Type != want {
+			t.Fatalf("notification type = %v (%v), want %v", n.Type, n.Error, want)
+		}
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %v", want)
+	}
+	return nil
+}
+
+func TestSubscribeMapsNotifications(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	session := jukeboxtest.Session("s1", running)
+	server.Notify(
+		jukeboxtest.InitialState(1, session, jukeboxtest.Track("t1", playing)),
+		jukeboxtest.ChangeTrack(2, session, jukeboxtest.Track("t2", v1.TrackState_TRACK_STATE_SKIPPED)),
+		jukeboxtest.ChangeTrack(3, session, jukeboxtest.Track("t3", started)),
+		jukeboxtest.ChangeState(4, jukeboxtest.Session("s1", terminated), nil),
+	)
+	c := newTestClient(t, server, 0)
+
+	n := expect(t, c, NotificationTypeSessionStart)
+	if n.Session.GetSessionId() != "s1" || n.Track.GetTrackId() != "t1" {
+		t.Errorf("session start = %v/%v, want s1/t1", n.Session.GetSessionId(), n.Track.GetTrackId())
+	}
+	if n := expect(t, c, NotificationTypeTrackUpdate); n.Track.GetState() != v1.TrackState_TRACK_STATE_SKIPPED {
+		t.Errorf("track update state = %v, want skipped", n.Track.GetState())
+	}
+	if n := expect(t, c, NotificationTypeTrackStart); n.Track.GetTrackId() != "t3" {
+		t.Errorf("track start = %v, want t3", n.Track.GetTrackId())
+	}
+	expect(t, c, NotificationTypeSessionEnd)
+}
+
+func TestSubscribeMapsSessionStates(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	want := []struct {
+		state v1.SessionState
+		typ   NotificationType
+	}{
+		{waiting, NotificationTypeSessionWaiting},
+		{running, NotificationTypeSessionStart},
+		{v1.SessionState_SESSION_STATE_PAUSED, NotificationTypeSessionPaused},
+		{running, NotificationTypeSessionStart},
+		{v1.SessionState_SESSION_STATE_WAITING_FOR_TRACKS, NotificationTypeSessionWaitingForTracks},
+		{v1.SessionState_SESSION_STATE_ENDING, NotificationTypeSessionEnding},
+		{terminated, NotificationTypeSessionEnd},
+	}
+	server.Notify(jukeboxtest.InitialState(1, jukeboxtest.Session("s1", want[0].state), nil))
+	for n, w := range want[1:] {
+		server.Notify(jukeboxtest.ChangeState(uint64(n+2), jukeboxtest.Session("s1", w.state), nil))
+	}
+	c := newTestClient(t, server, 0)
+
+	for _, w := range want {
+		if n := expect(t, c, w.typ); n.Session.GetState() != w.state {
+			t.Errorf("%v: session state = %v, want %v", w.typ, n.Session.GetState(), w.state)
+		}
+	}
+}
+
+func TestSubscribeWithoutReconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		end  jukeboxtest.Step
+		want NotificationType
+	}{
+		{"close", jukeboxtest.Step{Close: true}, NotificationTypeStreamClosed},
+		{"error", jukeboxtest.Step{Error: connect.NewError(connect.CodeInternal, errors.New("boom"))}, NotificationTypeStreamError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := jukeboxtest.NewServer(t)
+			server.Push(tt.end)
+			c := newTestClient(t, server, 0)
+
+			expect(t, c, tt.want)
+			if got := server.Subscriptions(); got != 1 {
+				t.Errorf("subscriptions = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSubscribeReconnects(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	session := jukeboxtest.Session("s1", running)
+	server.Notify(jukeboxtest.InitialState(1, session, jukeboxtest.Track("t1", playing)))
+	server.Push(jukeboxtest.Step{Error: connect.NewError(connect.CodeUnavailable, errors.New("restarting"))})
+	server.Notify(jukeboxtest.InitialState(1, session, jukeboxtest.Track("t2", playing)))
+	c := newTestClient(t, server, time.Minute)
+
+	expect(t, c, NotificationTypeSessionStart)
+	expect(t, c, NotificationTypeStreamReconnecting)
+	if n := expect(t, c, NotificationTypeSessionStart); n.Track.GetTrackId() != "t2" {
+		t.Errorf("resumed track = %v, want t2", n.Track.GetTrackId())
+	}
+	if got := server.Subscriptions(); got != 2 {
+		t.Errorf("subscriptions = %d, want 2", got)
+	}
+}
+
+func TestSubscribeBeforeServerStarts(t *testing.T) {
+	server := jukeboxtest.NewUnstartedServer(t)
+	server.Notify(jukeboxtest.InitialState(1, jukeboxtest.Session("s1", running), nil))
+	c := newTestClient(t, server, time.Minute)
+
+	if n := expect(t, c, NotificationTypeStreamReconnecting); n.Error == nil {
+		t.Error("reconnecting notification has no error")
+	}
+	server.Start()
+	if n := expect(t, c, NotificationTypeSessionStart); n.Session.GetSessionId() != "s1" {
+		t.Errorf("started session = %v, want s1", n.Session.GetSessionId())
+	}
+
+	// without reconnection the first failure is final
+	c = newTestClient(t, jukeboxtest.NewUnstartedServer(t), 0)
+	expect(t, c, NotificationTypeStreamError)
+}
+
+func TestSubscribeEndsSessionReplacedWhileDisconnected(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	server.Notify(jukeboxtest.InitialState(1, jukeboxtest.Session("s1", running), nil))
+	server.Push(jukeboxtest.Step{Close: true})
+	server.Notify(jukeboxtest.InitialState(1, jukeboxtest.Session("s2", running), nil))
+	c := newTestClient(t, server, time.Minute)
+
+	expect(t, c, NotificationTypeSessionStart)
+	expect(t, c, NotificationTypeStreamReconnecting)
+	if n := expect(t, c, NotificationTypeSessionEnd); n.Session.GetSessionId() != "s1" {
+		t.Errorf("ended session = %v, want s1", n.Session.GetSessionId())
+	}
+	if n := expect(t, c, NotificationTypeSessionStart); n.Session.GetSessionId() != "s2" {
+		t.Errorf("started session = %v, want s2", n.Session.GetSessionId())
+	}
+}
+
+func TestSubscribeKeepsWaitingSessionWhileDisconnected(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	server.Notify(jukeboxtest.InitialState(1, jukeboxtest.Session("s1", waiting), nil))
+	server.Push(jukeboxtest.Step{Close: true})
+	server.Notify(
+		jukeboxtest.InitialState(1, jukeboxtest.Session("s1", waiting), nil),
+		jukeboxtest.ChangeState(2, jukeboxtest.Session("s1", running), nil),
+	)
+	c := newTestClient(t, server, time.Minute)
+
+	expect(t, c, NotificationTypeSessionWaiting)
+	expect(t, c, NotificationTypeStreamReconnecting)
+	// the session has not ended, so the resumed stream goes on waiting
+	expect(t, c, NotificationTypeSessionWaiting)
+	expect(t, c, NotificationTypeSessionStart)
+}
+
+func TestSubscribeGivesUp(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	server.Notify(jukeboxtest.InitialState(1, jukeboxtest.Session("s1", running), nil))
+	c := newTestClient(t, server, 200*time.Millisecond)
+	expect(t, c, NotificationTypeSessionStart)
+
+	server.Close()
+	expect(t, c, NotificationTypeStreamReconnecting)
+	if n := expect(t, c, NotificationTypeStreamError); n.Error == nil {
+		t.Error("give-up notification has no error")
+	}
+}
+
+func TestSubscribeResyncsOnSequenceGap(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	session := jukeboxtest.Session("s1", running)
+	server.SetStatus(&v1.GetStatusResponse{
+		SessionInfo:  session,
+		CurrentTrack: jukeboxtest.Track("t3", playing),
+	})
+	server.Notify(
+		jukeboxtest.InitialState(10, session, nil),
+		jukeboxtest.ChangeTrack(11, session, jukeboxtest.Track("t1", started)),
+		jukeboxtest.ChangeTrack(14, session, jukeboxtest.Track("t4", started)),
+		jukeboxtest.ChangeTrack(2, session, jukeboxtest.Track("t5", started)),
+	)
+	c := newTestClient(t, server, 0)
+
+	expect(t, c, NotificationTypeSessionStart)
+	expect(t, c, NotificationTypeTrackStart)
+	n := expect(t, c, NotificationTypeSequenceGap)
+	if n.Track.GetTrackId() != "t3" || n.Session.GetSessionId() != "s1" {
+		t.Errorf("resynced state = %v/%v, want s1/t3", n.Session.GetSessionId(), n.Track.GetTrackId())
+	}
+	if n := expect(t, c, NotificationTypeTrackStart); n.Track.GetTrackId() != "t4" {
+		t.Errorf("track start = %v, want t4", n.Track.GetTrackId())
+	}
+	// a regression (server restart) resyncs as well
+	expect(t, c, NotificationTypeSequenceGap)
+	expect(t, c, NotificationTypeTrackStart)
+}
+
+func TestJoinAndRequest(t *testing.T) {
+	server := jukeboxtest.NewServer(t)
+	server.RequestTrackFunc = func(req *v1.RequestTrackRequest) (*v1.RequestTrackResponse, error) {
+		if req.TrackId == "restricted" {
+			return &v1.RequestTrackResponse{Success: false, Message: "not in this market", Code: "MARKET_RESTRICTION"}, nil
+		}
+		return &v1.RequestTrackResponse{Success: true, Message: "accepted", Code: "OK"}, nil
+	}
+	c := NewClient(server.URL, 0)
+	ctx := context.Background()
+
+	listenerID, err := c.Join(ctx, "alice", "123")
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if listenerID == "" {
+		t.Fatal("Join returned an empty listener ID")
+	}
+
+	result, err := c.Request(ctx, listenerID, "t1")
+	if want := (RequestResult{Success: true, Code: RequestCodeAccepted, RawCode: "OK", Message: "accepted"}); err != nil || result != want {
+		t.Errorf("Request(t1) = %+v, %v, want %+v", result, err, want)
+	}
+	result, err = c.Request(ctx, listenerID, "restricted")
+	if want := (RequestResult{Code: RequestCodeMarketRestriction, RawCode: "MARKET_RESTRICTION", Message: "not in this market"}); err != nil || result != want {
+		t.Errorf("Request(restricted) = %+v, %v, want %+v", result, err, want)
+	}
+	_, err = c.Request(ctx, "unknown", "t1")
+	if connect.CodeOf(err) != connect.CodeNotFound {
+		t.Errorf("Request(unknown listener) error = %v, want not found", err)
+	}
+	if !IsListenerRejected(err, "unknown") {
+		t.Errorf("IsListenerRejected(%v) = false, want true", err)
+	}
+	if got := len(server.Requests()); got != 1 {
+		t.Errorf("accepted requests = %d, want 1", got)
+	}
+}
+
+func TestNewRequestResult(t *testing.T) {
+	tests := []struct {
+		success bool
+		code    string
+		want    RequestCode
+	}{
+		{true, "", RequestCodeAccepted},
+		{true, "OK", RequestCodeAccepted},
+		{false, "user_pending", RequestCodeUserPending},
+		{false, "KICKED", RequestCodeKicked},
+		{false, "market_restriction", RequestCodeMarketRestriction},
+		// codes the proto does not document keep their raw code only
+		{false, "duplicate", RequestCodeUnknown},
+		{false, "cosmic_rays", RequestCodeUnknown},
+		{false, "", RequestCodeUnknown},
+	}
+	for _, tt := range tests {
+		result := newRequestResult(tt.success, tt.code, "message")
+		if result.Code != tt.want || result.RawCode != tt.code || result.Message != "message" {
+			t.Errorf("newRequestResult(%v, %q) = %+v, want code %s", tt.success, tt.code, result, tt.want)
+		}
+	}
+	rejections := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{connect.NewError(connect.CodeNotFound, errors.New("listener not found")), true},
+		{errors.Wrap(connect.NewError(connect.CodeNotFound, errors.New("no such ID: l1")), "error requesting track"), true},
+		{connect.NewError(connect.CodeNotFound, errors.New("track not found")), false},
+		{connect.NewError(connect.CodeUnauthenticated, errors.New("bad token")), false},
+		{errors.New("listener not found"), false},
+	}
+	for _, tt := range rejections {
+		if got := IsListenerRejected(tt.err, "l1"); got != tt.want {
+			t.Errorf("IsListenerRejected(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+	if IsListenerRejected(connect.NewError(connect.CodePermissionDenied, errors.New("kicked")), "l1") {
+		t.Error("IsListenerRejected(permission denied) = true, want kicked listeners excluded")
+	}
+}
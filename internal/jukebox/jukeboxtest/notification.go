@@ -0,0 +1,58 @@
+package jukeboxtest
+
+import (
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+)
+
+// InitialState returns the notification sent at the start of a stream.
+func InitialState(sequenceNo uint64, session *v1.SessionInfo, track *v1.TrackInfo) *v1.Notification {
+	return &v1.Notification{
+		Type:        v1.NotificationType_NOTIFICATION_TYPE_INITIAL_STATE,
+		SequenceNo:  sequenceNo,
+		SessionInfo: session,
+		TrackInfo:   track,
+	}
+}
+
+// ChangeState returns a session state change notification.
+func ChangeState(sequenceNo uint64, session *v1.SessionInfo, track *v1.TrackInfo) *v1.Notification {
+	return &v1.Notification{
+		Type:        v1.NotificationType_NOTIFICATION_TYPE_CHANGE_STATE,
+		SequenceNo:  sequenceNo,
+		SessionInfo: session,
+		TrackInfo:   track,
+	}
+}
+
+// ChangeTrack returns a track state change notification.
+func ChangeTrack(sequenceNo uint64, session *v1.SessionInfo, track *v1.TrackInfo) *v1.Notification {
+	return &v1.Notification{
+		Type:        v1.NotificationType_NOTIFICATION_TYPE_CHANGE_TRACK,
+		SequenceNo:  sequenceNo,
+		SessionInfo: session,
+		TrackInfo:   track,
+	}
+}
+
+// Session returns a session in state.
+func Session(sessionID string, state v1.SessionState) *v1.SessionInfo {
+	return &v1.SessionInfo{
+		SessionId:         sessionID,
+		PlaylistName:      "playlist " + sessionID,
+		PlaylistUrl:       "https://open.spotify.com/playlist/" + sessionID,
+		State:             state,
+		AcceptingRequests: state == v1.SessionState_SESSION_STATE_RUNNING,
+	}
+}
+
+// Track returns a track in state.
+func Track(trackID string, state v1.TrackState) *v1.TrackInfo {
+	return &v1.TrackInfo{
+		TrackId:          trackID,
+		Name:             "track " + trackID,
+		Artists:          []string{"artist " + trackID},
+		Url:              "https://open.spotify.com/track/" + trackID,
+		RemainingSeconds: 180,
+		State:            state,
+	}
+}
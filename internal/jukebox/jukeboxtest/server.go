@@ -0,0 +1,305 @@
+// Package jukeboxtest provides an in-process fake 19box server for tests.
+package jukeboxtest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/cockroachdb/errors"
+	v1 "github.com/osa030/19box-discordbot/internal/gen/jukebox/v1"
+	"github.com/osa030/19box-discordbot/internal/gen/jukebox/v1/jukeboxv1connect"
+)
+
+// Step is one entry of the notification timeline. Exactly one field is set.
+type Step struct {
+	// Notification is sent to the subscriber.
+	Notification *v1.Notification
+	// Close ends the stream without an error.
+	Close bool
+	// Error ends the stream with this error.
+	Error error
+}
+
+// Server is a fake 19box server implementing ListenerService and
+// AdminService over HTTP.
+//
+// Notifications are scripted as a timeline of Steps. Each subscription
+// consumes steps in order until a Close or Error step ends it, and the next
+// subscription carries on from there, so a server restart is scripted as
+// [..., Close, initial state, ...]. Like the real server, which sends the
+// initial state right away, a subscription is not established until its
+// first step is available, so queue steps before subscribing.
+type Server struct {
+	URL string
+
+	// RequestTrackFunc decides the response to RequestTrack from a joined
+	// listener. It accepts every request when nil.
+	RequestTrackFunc func(req *v1.RequestTrackRequest) (*v1.RequestTrackResponse, error)
+
+	srv   *httptest.Server
+	addr  string
+	steps chan Step
+	done  chan struct{}
+
+	mu            sync.Mutex
+	status        *v1.GetStatusResponse
+	listeners     []*v1.ListenerInfo
+	externalIDs   map[string]string
+	joins         int
+	requests      []*v1.RequestTrackRequest
+	adminCalls    []string
+	subscriptions int
+	closeOnce     sync.Once
+}
+
+var (
+	_ jukeboxv1connect.ListenerServiceHandler = (*Server)(nil)
+	_ jukeboxv1connect.AdminServiceHandler    = (*Server)(nil)
+)
+
+// NewServer starts a fake server that is closed when t finishes.
+func NewServer(t testing.TB) *Server {
+	s := NewUnstartedServer(t)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a fake server that refuses connections on its
+// URL until Start is called, as with a server that is not up yet. It is closed
+// when t finishes.
+func NewUnstartedServer(t testing.TB) *Server {
+	s := &Server{
+		steps:       make(chan Step, 64),
+		done:        make(chan struct{}),
+		status:      &v1.GetStatusResponse{},
+		externalIDs: map[string]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(jukeboxv1connect.NewListenerServiceHandler(s))
+	mux.Handle(jukeboxv1connect.NewAdminServiceHandler(s))
+	s.srv = httptest.NewUnstartedServer(mux)
+	// keep the address but refuse connections until Start
+	s.addr = s.srv.Listener.Addr().String()
+	_ = s.srv.Listener.Close()
+	s.URL = "http://" + s.addr
+
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Start starts serving on URL.
+func (s *Server) Start() {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		panic(fmt.Sprintf("jukeboxtest: failed to listen on %v: %v", s.addr, err))
+	}
+	s.srv.Listener = l
+	s.srv.Start()
+}
+
+// Close ends all streams and shuts the server down. Later calls fail to
+// connect, as with a stopped server.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.srv.Close()
+	})
+}
+
+// Push appends steps to the notification timeline.
+func (s *Server) Push(steps ...Step) {
+	for _, step := range steps {
+		s.steps <- step
+	}
+}
+
+// Notify appends notifications to the timeline.
+func (s *Server) Notify(notifications ...*v1.Notification) {
+	for _, n := range notifications {
+		s.Push(Step{Notification: n})
+	}
+}
+
+// SetStatus sets the response of GetStatus.
+func (s *Server) SetStatus(status *v1.GetStatusResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Subscriptions returns how many times SubscribeNotifications was called.
+func (s *Server) Subscriptions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions
+}
+
+// Requests returns the accepted RequestTrack calls in order.
+func (s *Server) Requests() []*v1.RequestTrackRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*v1.RequestTrackRequest(nil), s.requests...)
+}
+
+// AdminCalls returns the names of the AdminService methods called, in order.
+func (s *Server) AdminCalls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.adminCalls...)
+}
+
+// Listeners returns the joined listeners.
+func (s *Server) Listeners() []*v1.ListenerInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*v1.ListenerInfo(nil), s.listeners...)
+}
+
+// Joins returns how many times Join was called.
+func (s *Server) Joins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.joins
+}
+
+// ForgetListeners drops every joined listener, as a server restart does.
+func (s *Server) ForgetListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = nil
+	s.externalIDs = map[string]string{}
+}
+
+func (s *Server) listener(listenerID string) *v1.ListenerInfo {
+	for _, listener := range s.listeners {
+		if listener.ListenerId == listenerID {
+			return listener
+		}
+	}
+	return nil
+}
+
+// ListenerService
+
+func (s *Server) Join(_ context.Context, req *connect.Request[v1.JoinRequest]) (*connect.Response[v1.JoinResponse], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.joins++
+	listenerID := fmt.Sprintf("listener-%d", s.joins)
+	s.listeners = append(s.listeners, &v1.ListenerInfo{
+		ListenerId:  listenerID,
+		DisplayName: req.Msg.DisplayName,
+	})
+	s.externalIDs[listenerID] = req.Msg.ExternalUserId
+	return connect.NewResponse(&v1.JoinResponse{ListenerId: listenerID}), nil
+}
+
+func (s *Server) RequestTrack(_ context.Context, req *connect.Request[v1.RequestTrackRequest]) (*connect.Response[v1.RequestTrackResponse], error) {
+	s.mu.Lock()
+	listener := s.listener(req.Msg.ListenerId)
+	s.mu.Unlock()
+	if listener == nil {
+		return nil, connect.NewError(connect.CodeNotFound, errors.Newf("listener %s not found", req.Msg.ListenerId))
+	}
+
+	res := &v1.RequestTrackResponse{Success: true, Message: "accepted"}
+	if s.RequestTrackFunc != nil {
+		var err error
+		if res, err = s.RequestTrackFunc(req.Msg); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if res.Success {
+		s.requests = append(s.requests, req.Msg)
+		listener.PendingTracks++
+	}
+	return connect.NewResponse(res), nil
+}
+
+func (s *Server) SubscribeNotifications(ctx context.Context, _ *connect.Request[v1.SubscribeNotificationsRequest], stream *connect.ServerStream[v1.Notification]) error {
+	s.mu.Lock()
+	s.subscriptions++
+	s.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return connect.NewError(connect.CodeUnavailable, errors.New("server stopped"))
+		case step := <-s.steps:
+			switch {
+			case step.Close:
+				return nil
+			case step.Error != nil:
+				return step.Error
+			case step.Notification != nil:
+				if err := stream.Send(step.Notification); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// AdminService
+
+func (s *Server) recordAdminCall(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.adminCalls = append(s.adminCalls, name)
+}
+
+func (s *Server) GetStatus(context.Context, *connect.Request[v1.GetStatusRequest]) (*connect.Response[v1.GetStatusResponse], error) {
+	s.recordAdminCall("GetStatus")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return connect.NewResponse(s.status), nil
+}
+
+func (s *Server) Pause(context.Context, *connect.Request[v1.PauseRequest]) (*connect.Response[v1.PauseResponse], error) {
+	s.recordAdminCall("Pause")
+	return connect.NewResponse(&v1.PauseResponse{Success: true, Message: "paused"}), nil
+}
+
+func (s *Server) Resume(context.Context, *connect.Request[v1.ResumeRequest]) (*connect.Response[v1.ResumeResponse], error) {
+	s.recordAdminCall("Resume")
+	return connect.NewResponse(&v1.ResumeResponse{Success: true, Message: "resumed"}), nil
+}
+
+func (s *Server) Skip(context.Context, *connect.Request[v1.SkipRequest]) (*connect.Response[v1.SkipResponse], error) {
+	s.recordAdminCall("Skip")
+	return connect.NewResponse(&v1.SkipResponse{Success: true, Message: "skipped"}), nil
+}
+
+func (s *Server) Kick(_ context.Context, req *connect.Request[v1.KickRequest]) (*connect.Response[v1.KickResponse], error) {
+	s.recordAdminCall("Kick")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	listener := s.listener(req.Msg.ListenerId)
+	if listener == nil {
+		return connect.NewResponse(&v1.KickResponse{Success: false, Message: "listener not found"}), nil
+	}
+	listener.IsKicked = true
+	return connect.NewResponse(&v1.KickResponse{Success: true, Message: "kicked"}), nil
+}
+
+func (s *Server) ListListeners(context.Context, *connect.Request[v1.ListListenersRequest]) (*connect.Response[v1.ListListenersResponse], error) {
+	s.recordAdminCall("ListListeners")
+	return connect.NewResponse(&v1.ListListenersResponse{Listeners: s.Listeners()}), nil
+}
+
+func (s *Server) StopSession(context.Context, *connect.Request[v1.StopSessionRequest]) (*connect.Response[v1.StopSessionResponse], error) {
+	s.recordAdminCall("StopSession")
+	return connect.NewResponse(&v1.StopSessionResponse{Success: true, Message: "stopped"}), nil
+}
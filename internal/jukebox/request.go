@@ -0,0 +1,76 @@
+package jukebox
+
+import (
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/cockroachdb/errors"
+)
+
+// RequestCode is the outcome of a track request.
+type RequestCode string
+
+// The codes the server gives for a rejected request, as documented on
+// RequestTrackResponse.code in jukebox/v1/listener.proto.
+const (
+	RequestCodeAccepted RequestCode = "accepted"
+	// RequestCodeUserPending is a rejection because the listener already has
+	// a request waiting to be played.
+	RequestCodeUserPending RequestCode = "user_pending"
+	// RequestCodeKicked is a rejection because the listener was kicked.
+	RequestCodeKicked RequestCode = "kicked"
+	// RequestCodeMarketRestriction is a rejection because the track is not
+	// available in the market of the server.
+	RequestCodeMarketRestriction RequestCode = "market_restriction"
+	// RequestCodeUnknown is a rejection with any other code. Its RawCode and
+	// the message of the server tell more.
+	RequestCodeUnknown RequestCode = "unknown"
+)
+
+// requestCodes maps the codes sent by the server, lower-cased, to
+// RequestCode.
+var requestCodes = map[string]RequestCode{
+	"user_pending":       RequestCodeUserPending,
+	"kicked":             RequestCodeKicked,
+	"market_restriction": RequestCodeMarketRestriction,
+}
+
+// RequestResult is the answer of the server to a track request.
+type RequestResult struct {
+	Success bool
+	Code    RequestCode
+	// RawCode is the code as sent by the server.
+	RawCode string
+	// Message is the message the server has for the user.
+	Message string
+}
+
+// IsListenerRejected reports whether the request of listenerID failed because
+// the server does not know the listener, e.g. after a restart, so that joining
+// again may help: a NotFound error whose message names the listener. Other
+// things not found, such as the track, and kicked listeners are not included.
+func IsListenerRejected(err error, listenerID string) bool {
+	var connectErr *connect.Error
+	if !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeNotFound {
+		return false
+	}
+	message := strings.ToLower(connectErr.Message())
+	return strings.Contains(message, "listener") || (listenerID != "" && strings.Contains(message, strings.ToLower(listenerID)))
+}
+
+func newRequestResult(success bool, code string, message string) RequestResult {
+	result := RequestResult{
+		Success: success,
+		RawCode: code,
+		Message: message,
+	}
+	switch {
+	case success:
+		result.Code = RequestCodeAccepted
+	case requestCodes[strings.ToLower(code)] != "":
+		result.Code = requestCodes[strings.ToLower(code)]
+	default:
+		result.Code = RequestCodeUnknown
+	}
+	return result
+}
@@ -0,0 +1,207 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	defaultAccountsURL = "https://accounts.spotify.com"
+	defaultAPIURL      = "https://api.spotify.com/v1"
+	// pageSize is the most items the album and playlist endpoints return
+	// per page.
+	pageSize = 50
+	// tokenMargin is how long before it expires an access token is renewed.
+	tokenMargin = time.Minute
+)
+
+// ErrNotFound is returned for tracks, albums and playlists that do not exist
+// or are not visible to the client, such as private playlists.
+var ErrNotFound = errors.New("not found on Spotify")
+
+// Track is a track listed by the Web API.
+type Track struct {
+	ID      string
+	Name    string
+	Artists []string
+	// AlbumArtURL is the largest album art of the track. It is only set for
+	// tracks looked up on their own.
+	AlbumArtURL string
+}
+
+// Client looks up tracks and lists the tracks of albums and playlists with
+// the Spotify Web API, authenticated with the client credentials flow.
+type Client struct {
+	clientID     string
+	clientSecret string
+	httpClient   *http.Client
+	accountsURL  string
+	apiURL       string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClient returns a Client for the app clientID.
+func NewClient(clientID string, clientSecret string) *Client {
+	return &Client{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		accountsURL:  defaultAccountsURL,
+		apiURL:       defaultAPIURL,
+	}
+}
+
+// Track looks up the track trackID.
+func (c *Client) Track(ctx context.Context, trackID string) (Track, error) {
+	var track trackItem
+	if err := c.get(ctx, c.apiURL+"/tracks/"+url.PathEscape(trackID), &track); err != nil {
+		return Track{}, errors.Wrapf(err, "error looking up track %s", trackID)
+	}
+	return track.toTrack(), nil
+}
+
+// Tracks returns up to limit tracks of the album or playlist link, in order.
+// Local files and podcast episodes in playlists are skipped.
+func (c *Client) Tracks(ctx context.Context, link Link, limit int) ([]Track, error) {
+	var path string
+	switch link.Kind {
+	case KindAlbum:
+		path = "/albums/" + link.ID + "/tracks"
+	case KindPlaylist:
+		path = "/playlists/" + link.ID + "/tracks"
+	default:
+		return nil, errors.Newf("cannot list the tracks of a %s", link.Kind)
+	}
+
+	var tracks []Track
+	next := c.apiURL + path + "?limit=" + strconv.Itoa(pageSize)
+	for next != "" && len(tracks) < limit {
+		var page trackPage
+		if err := c.get(ctx, next, &page); err != nil {
+			return nil, errors.Wrapf(err, "error listing %s %s", link.Kind, link.ID)
+		}
+		for _, item := range page.Items {
+			// playlist items wrap the track
+			track := item.trackItem
+			if item.Track != nil {
+				track = *item.Track
+			}
+			if track.ID == "" || track.IsLocal || (track.Type != "" && track.Type != string(KindTrack)) {
+				continue
+			}
+			tracks = append(tracks, track.toTrack())
+		}
+		next = page.Next
+	}
+	return tracks[:min(len(tracks), limit)], nil
+}
+
+type trackPage struct {
+	Items []struct {
+		trackItem
+		Track *trackItem `json:"track"`
+	} `json:"items"`
+	Next string `json:"next"`
+}
+
+type trackItem struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	IsLocal bool   `json:"is_local"`
+	Artists []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+	// Album is only included when tracks are not listed from their album.
+	Album struct {
+		// Images are ordered from the largest.
+		Images []struct {
+			URL string `json:"url"`
+		} `json:"images"`
+	} `json:"album"`
+}
+
+func (t trackItem) toTrack() Track {
+	track := Track{ID: t.ID, Name: t.Name}
+	for _, artist := range t.Artists {
+		track.Artists = append(track.Artists, artist.Name)
+	}
+	if len(t.Album.Images) > 0 {
+		track.AlbumArtURL = t.Album.Images[0].URL
+	}
+	return track
+}
+
+// get fetches the API endpoint u into v.
+func (c *Client) get(ctx context.Context, u string, v any) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return do(c.httpClient, req, v)
+}
+
+// accessToken returns the cached access token, requesting a new one when it
+// is about to expire.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.accountsURL+"/api/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	req.SetBasicAuth(c.clientID, c.clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := do(c.httpClient, req, &token); err != nil {
+		return "", errors.Wrap(err, "error getting Spotify access token")
+	}
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenMargin)
+	return c.token, nil
+}
+
+// do sends req with httpClient and decodes the JSON response into v.
+func do(httpClient *http.Client, req *http.Request, v any) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errors.WithStack(ErrNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return errors.Newf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "error decoding %s", req.URL.Path)
+	}
+	return nil
+}
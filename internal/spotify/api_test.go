@@ -0,0 +1,118 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+)
+
+func newTestClient(t *testing.T, handler http.Handler) (*Client, *int) {
+	t.Helper()
+	tokens := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "id" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			http.Error(w, "bad credentials", http.StatusUnauthorized)
+			return
+		}
+		tokens++
+		fmt.Fprint(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+	})
+	mux.Handle("/v1/", http.StripPrefix("/v1", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	c := NewClient("id", "secret")
+	c.accountsURL = server.URL
+	c.apiURL = server.URL + "/v1"
+	return c, &tokens
+}
+
+func TestClientTracks(t *testing.T) {
+	var serverURL string
+	c, tokens := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/albums/" + testID + "/tracks":
+			fmt.Fprint(w, `{"items":[
+				{"id":"a1","name":"One","type":"track","artists":[{"name":"X"},{"name":"Y"}]},
+				{"id":"a2","name":"Two","type":"track","artists":[{"name":"X"}]}
+			],"next":null}`)
+		case "/playlists/" + testID + "/tracks":
+			if r.URL.Query().Get("offset") == "" {
+				fmt.Fprintf(w, `{"items":[
+					{"is_local":false,"track":{"id":"p1","name":"One","type":"track","artists":[{"name":"X"}]}},
+					{"is_local":true,"track":{"id":null,"name":"Local","type":"track","artists":[]}},
+					{"is_local":false,"track":{"id":"e1","name":"Episode","type":"episode"}},
+					{"is_local":false,"track":null}
+				],"next":"%s/v1/playlists/%s/tracks?offset=4"}`, serverURL, testID)
+				return
+			}
+			fmt.Fprint(w, `{"items":[
+				{"track":{"id":"p2","name":"Two","type":"track","artists":[{"name":"Y"}]}},
+				{"track":{"id":"p3","name":"Three","type":"track","artists":[{"name":"Z"}]}}
+			],"next":null}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	serverURL = c.accountsURL
+	ctx := context.Background()
+
+	album, err := c.Tracks(ctx, Link{KindAlbum, testID}, 10)
+	if err != nil || len(album) != 2 || album[0].ID != "a1" || album[0].Name != "One" || len(album[0].Artists) != 2 {
+		t.Errorf("album tracks = %+v, %v", album, err)
+	}
+
+	playlist, err := c.Tracks(ctx, Link{KindPlaylist, testID}, 2)
+	if err != nil || len(playlist) != 2 || playlist[0].ID != "p1" || playlist[1].ID != "p2" {
+		t.Errorf("playlist tracks = %+v, %v, want p1 and p2", playlist, err)
+	}
+
+	if _, err := c.Tracks(ctx, Link{KindPlaylist, "missing"}, 10); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing playlist error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := c.Tracks(ctx, Link{KindArtist, testID}, 10); err == nil {
+		t.Error("artist tracks error = nil, want an error")
+	}
+	if *tokens != 1 {
+		t.Errorf("access tokens requested = %d, want 1", *tokens)
+	}
+}
+
+func TestClientTrack(t *testing.T) {
+	c, _ := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tracks/"+testID {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"%s","name":"One","type":"track","artists":[{"name":"X"},{"name":"Y"}],
+			"album":{"images":[{"url":"https://i.scdn.co/image/large","width":640},{"url":"https://i.scdn.co/image/small","width":64}]}}`, testID)
+	}))
+	ctx := context.Background()
+
+	track, err := c.Track(ctx, testID)
+	if err != nil || track.ID != testID || track.Name != "One" || len(track.Artists) != 2 || track.AlbumArtURL != "https://i.scdn.co/image/large" {
+		t.Errorf("Track = %+v, %v", track, err)
+	}
+	if _, err := c.Track(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing track error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestClientBadCredentials(t *testing.T) {
+	c, _ := newTestClient(t, http.NotFoundHandler())
+	c.clientSecret = "wrong"
+	if _, err := c.Tracks(context.Background(), Link{KindAlbum, testID}, 10); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Tracks() error = %v, want an authentication error", err)
+	}
+}
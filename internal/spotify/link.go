@@ -0,0 +1,143 @@
+// Package spotify parses Spotify links and lists the tracks of albums and
+// playlists with the Spotify Web API.
+package spotify
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+var (
+	// ErrNotSpotify is returned for input that is neither a Spotify link nor
+	// a Spotify ID.
+	ErrNotSpotify = errors.New("not a Spotify link")
+	// ErrNotTrack is returned by ParseTrack for links to something other
+	// than a track, such as an album or a playlist.
+	ErrNotTrack = errors.New("not a Spotify track")
+	// ErrInvalidID is returned for links whose ID is malformed.
+	ErrInvalidID = errors.New("invalid Spotify ID")
+)
+
+// Kind is the kind of item a link points to.
+type Kind string
+
+const (
+	KindTrack    Kind = "track"
+	KindAlbum    Kind = "album"
+	KindPlaylist Kind = "playlist"
+	KindArtist   Kind = "artist"
+	KindEpisode  Kind = "episode"
+	KindShow     Kind = "show"
+)
+
+var kinds = map[string]Kind{
+	string(KindTrack):    KindTrack,
+	string(KindAlbum):    KindAlbum,
+	string(KindPlaylist): KindPlaylist,
+	string(KindArtist):   KindArtist,
+	string(KindEpisode):  KindEpisode,
+	string(KindShow):     KindShow,
+}
+
+// idPattern matches a base62 Spotify ID.
+var idPattern = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// linkPattern finds the Spotify URLs and URIs in text.
+var linkPattern = regexp.MustCompile(`(?i)(?:https?://)?(?:open|play)\.spotify\.com/[^\s<>()]+|spotify:[a-z]+:[0-9A-Za-z]+`)
+
+// Link is a parsed Spotify link.
+type Link struct {
+	Kind Kind
+	ID   string
+}
+
+// URL returns the canonical open.spotify.com URL of the link.
+func (l Link) URL() string {
+	return "https://open.spotify.com/" + string(l.Kind) + "/" + l.ID
+}
+
+// Parse parses an open.spotify.com URL, a spotify: URI or a bare ID, which is
+// taken to be a track. Locale segments such as /intl-ja/ and query parameters
+// such as ?si= are dropped.
+func Parse(input string) (Link, error) {
+	input = strings.TrimSpace(input)
+	// Discord users wrap links in <> to suppress their embeds
+	input = strings.TrimSuffix(strings.TrimPrefix(input, "<"), ">")
+
+	var kind, id string
+	switch {
+	case idPattern.MatchString(input):
+		kind, id = string(KindTrack), input
+	case strings.HasPrefix(input, "spotify:"):
+		parts := strings.Split(input, ":")
+		if len(parts) != 3 {
+			return Link{}, errors.Wrapf(ErrNotSpotify, "malformed URI %q", input)
+		}
+		kind, id = parts[1], parts[2]
+	default:
+		var err error
+		if kind, id, err = parseURL(input); err != nil {
+			return Link{}, err
+		}
+	}
+
+	k, ok := kinds[kind]
+	if !ok {
+		return Link{}, errors.Wrapf(ErrNotSpotify, "unknown kind %q", kind)
+	}
+	if !idPattern.MatchString(id) {
+		return Link{}, errors.Wrapf(ErrInvalidID, "%q", id)
+	}
+	return Link{Kind: k, ID: id}, nil
+}
+
+func parseURL(input string) (string, string, error) {
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", "", errors.Wrapf(ErrNotSpotify, "%v", err)
+	}
+	switch strings.ToLower(u.Hostname()) {
+	case "open.spotify.com", "play.spotify.com":
+	default:
+		return "", "", errors.Wrapf(ErrNotSpotify, "host %q", u.Hostname())
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "intl-") {
+		segments = segments[1:]
+	}
+	if len(segments) != 2 {
+		return "", "", errors.Wrapf(ErrNotSpotify, "path %q", u.Path)
+	}
+	return segments[0], segments[1], nil
+}
+
+// ParseTrack parses input as Parse does and returns the track ID. Links to
+// anything but a track fail with ErrNotTrack.
+func ParseTrack(input string) (string, error) {
+	link, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+	if link.Kind != KindTrack {
+		return "", errors.Wrapf(ErrNotTrack, "%s link", link.Kind)
+	}
+	return link.ID, nil
+}
+
+// FindTrack returns the track ID of the first link to a track in text, such as
+// a chat message. Links to anything else are skipped.
+func FindTrack(text string) (string, bool) {
+	for _, candidate := range linkPattern.FindAllString(text, -1) {
+		if id, err := ParseTrack(candidate); err == nil {
+			return id, true
+		}
+	}
+	return "", false
+}
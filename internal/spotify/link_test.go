@@ -0,0 +1,109 @@
+package spotify
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/errors"
+)
+
+const testID = "4uLU6hMCjMI75M1A2tKUQC"
+
+func TestParseTrack(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr error
+	}{
+		{"URL", "https://open.spotify.com/track/" + testID, testID, nil},
+		{"share URL", "https://open.spotify.com/track/" + testID + "?si=1a2b3c4d5e6f", testID, nil},
+		{"intl URL", "https://open.spotify.com/intl-ja/track/" + testID + "?si=abc", testID, nil},
+		{"trailing slash", "https://open.spotify.com/track/" + testID + "/", testID, nil},
+		{"no scheme", "open.spotify.com/track/" + testID, testID, nil},
+		{"http", "http://open.spotify.com/track/" + testID, testID, nil},
+		{"play host", "https://play.spotify.com/track/" + testID, testID, nil},
+		{"embed suppressed", "<https://open.spotify.com/track/" + testID + ">", testID, nil},
+		{"spaces", "  https://open.spotify.com/track/" + testID + " \n", testID, nil},
+		{"URI", "spotify:track:" + testID, testID, nil},
+		{"bare ID", testID, testID, nil},
+
+		{"album", "https://open.spotify.com/album/" + testID, "", ErrNotTrack},
+		{"playlist", "https://open.spotify.com/intl-en/playlist/" + testID + "?si=x", "", ErrNotTrack},
+		{"playlist URI", "spotify:playlist:" + testID, "", ErrNotTrack},
+		{"artist", "https://open.spotify.com/artist/" + testID, "", ErrNotTrack},
+		{"episode", "https://open.spotify.com/episode/" + testID, "", ErrNotTrack},
+
+		{"YouTube", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "", ErrNotSpotify},
+		{"lookalike host", "https://open.spotify.com.example.com/track/" + testID, "", ErrNotSpotify},
+		{"user page", "https://open.spotify.com/user/someone", "", ErrNotSpotify},
+		{"no ID", "https://open.spotify.com/track", "", ErrNotSpotify},
+		{"unknown kind", "spotify:concert:" + testID, "", ErrNotSpotify},
+		{"malformed URI", "spotify:track", "", ErrNotSpotify},
+		{"text", "never gonna give you up", "", ErrNotSpotify},
+		{"empty", "", "", ErrNotSpotify},
+
+		{"short ID", "https://open.spotify.com/track/abc", "", ErrInvalidID},
+		{"bad ID", "spotify:track:" + testID[:21] + "!", "", ErrInvalidID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTrack(tt.input)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseTrack(%q) = %q, %v, want %v", tt.input, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseTrack(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Link
+	}{
+		{"https://open.spotify.com/intl-ja/album/" + testID + "?si=x", Link{KindAlbum, testID}},
+		{"spotify:playlist:" + testID, Link{KindPlaylist, testID}},
+		{testID, Link{KindTrack, testID}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", tt.input, got, err, tt.want)
+		}
+	}
+	if got, want := (Link{KindTrack, testID}).URL(), "https://open.spotify.com/track/"+testID; got != want {
+		t.Errorf("URL() = %q, want %q", got, want)
+	}
+}
+
+func TestFindTrack(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"link only", "https://open.spotify.com/track/" + testID, testID},
+		{"in sentence", "これ良かった→https://open.spotify.com/intl-ja/track/" + testID + "?si=abc おすすめ", testID},
+		{"suppressed embed", "check <https://open.spotify.com/track/" + testID + ">", testID},
+		{"markdown link", "[song](https://open.spotify.com/track/" + testID + ")", testID},
+		{"URI", "try spotify:track:" + testID + " maybe", testID},
+		{"after album", "https://open.spotify.com/album/0000000000000000000000 and https://open.spotify.com/track/" + testID, testID},
+		{"first track", "https://open.spotify.com/track/" + testID + " https://open.spotify.com/track/1111111111111111111111", testID},
+		{"album only", "https://open.spotify.com/album/" + testID, ""},
+		{"bare ID", testID, ""},
+		{"no link", "今日のセッション楽しみ", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FindTrack(tt.text)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("FindTrack(%q) = %q, %v, want %q", tt.text, got, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package spotify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+const defaultOEmbedURL = "https://open.spotify.com/oembed"
+
+// OEmbedClient looks up tracks with the oEmbed endpoint of Spotify, which
+// needs no credentials but only tells the name and the album art of a track.
+type OEmbedClient struct {
+	httpClient *http.Client
+	oembedURL  string
+}
+
+// NewOEmbedClient returns an OEmbedClient.
+func NewOEmbedClient() *OEmbedClient {
+	return &OEmbedClient{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		oembedURL:  defaultOEmbedURL,
+	}
+}
+
+// Track looks up the track trackID. Its artists are not known.
+func (c *OEmbedClient) Track(ctx context.Context, trackID string) (Track, error) {
+	link := Link{Kind: KindTrack, ID: trackID}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.oembedURL+"?url="+url.QueryEscape(link.URL()), nil)
+	if err != nil {
+		return Track{}, errors.WithStack(err)
+	}
+	var embed struct {
+		Title        string `json:"title"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := do(c.httpClient, req, &embed); err != nil {
+		return Track{}, errors.Wrapf(err, "error looking up track %s", trackID)
+	}
+	return Track{ID: trackID, Name: embed.Title, AlbumArtURL: embed.ThumbnailURL}, nil
+}
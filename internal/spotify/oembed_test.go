@@ -0,0 +1,33 @@
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+)
+
+func TestOEmbedClientTrack(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("url") != "https://open.spotify.com/track/"+testID {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"html":"<iframe></iframe>","title":"One","thumbnail_url":"https://image-cdn.spotifycdn.com/art","type":"rich"}`)
+	}))
+	t.Cleanup(server.Close)
+	c := NewOEmbedClient()
+	c.oembedURL = server.URL
+	ctx := context.Background()
+
+	track, err := c.Track(ctx, testID)
+	if err != nil || track.ID != testID || track.Name != "One" || track.AlbumArtURL != "https://image-cdn.spotifycdn.com/art" {
+		t.Errorf("Track = %+v, %v", track, err)
+	}
+	if _, err := c.Track(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing track error = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// FileStore keeps state in a single JSON file. Every Save rewrites the file
+// through a temporary file so a crash never leaves it half written.
+type FileStore struct {
+	path     string
+	mu       sync.Mutex
+	sessions map[string]*SessionState
+	history  map[string][]HistoryTrack
+}
+
+type fileContent struct {
+	Sessions map[string]*SessionState  `json:"sessions"`
+	History  map[string][]HistoryTrack `json:"history,omitempty"`
+}
+
+// NewFileStore opens the state file at path, creating it on the first Save
+// if it does not exist.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:     path,
+		sessions: map[string]*SessionState{},
+		history:  map[string][]HistoryTrack{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading state file")
+	}
+
+	var content fileContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, errors.Wrap(err, "error parsing state file")
+	}
+	if content.Sessions != nil {
+		s.sessions = content.Sessions
+	}
+	if content.History != nil {
+		s.history = content.History
+	}
+	return s, nil
+}
+
+func (s *FileStore) Load(sessionID string) (*SessionState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[sessionID], nil
+}
+
+func (s *FileStore) Save(state *SessionState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[state.SessionID] = state
+	return s.flush()
+}
+
+func (s *FileStore) Delete(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[sessionID]; !ok {
+		return nil
+	}
+	delete(s.sessions, sessionID)
+	return s.flush()
+}
+
+func (s *FileStore) LoadHistory(guildID string) ([]HistoryTrack, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history[guildID], nil
+}
+
+func (s *FileStore) SaveHistory(guildID string, tracks []HistoryTrack) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.history[guildID] = tracks
+	return s.flush()
+}
+
+func (s *FileStore) flush() error {
+	data, err := json.MarshalIndent(fileContent{Sessions: s.sessions, History: s.history}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding state file")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "error creating state file")
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return errors.Wrap(err, "error writing state file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "error writing state file")
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return errors.Wrap(err, "error replacing state file")
+	}
+	return nil
+}
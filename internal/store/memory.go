@@ -0,0 +1,44 @@
+package store
+
+import (
+	"github.com/puzpuzpuz/xsync/v3"
+)
+
+// MemoryStore keeps state in memory only. It is used when no state file is
+// configured, so state is lost on restart.
+type MemoryStore struct {
+	sessions *xsync.MapOf[string, *SessionState]
+	history  *xsync.MapOf[string, []HistoryTrack]
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: xsync.NewMapOf[string, *SessionState](),
+		history:  xsync.NewMapOf[string, []HistoryTrack](),
+	}
+}
+
+func (s *MemoryStore) Load(sessionID string) (*SessionState, error) {
+	state, _ := s.sessions.Load(sessionID)
+	return state, nil
+}
+
+func (s *MemoryStore) Save(state *SessionState) error {
+	s.sessions.Store(state.SessionID, state)
+	return nil
+}
+
+func (s *MemoryStore) Delete(sessionID string) error {
+	s.sessions.Delete(sessionID)
+	return nil
+}
+
+func (s *MemoryStore) LoadHistory(guildID string) ([]HistoryTrack, error) {
+	tracks, _ := s.history.Load(guildID)
+	return tracks, nil
+}
+
+func (s *MemoryStore) SaveHistory(guildID string, tracks []HistoryTrack) error {
+	s.history.Store(guildID, tracks)
+	return nil
+}
@@ -0,0 +1,73 @@
+// Package store persists bot state across restarts.
+package store
+
+import "time"
+
+// SessionState is the bot state of a single jukebox session.
+type SessionState struct {
+	SessionID string `json:"session_id"`
+	// Started is set once the session has left the waiting state, so a
+	// session that never started is told apart after a restart.
+	Started bool `json:"started,omitempty"`
+	// TopicIDs maps guild IDs to the forum thread the session is posted to.
+	TopicIDs map[string]string `json:"topic_ids,omitempty"`
+	// NowPlayingIDs maps guild IDs to the live now playing message in the
+	// topic.
+	NowPlayingIDs map[string]string `json:"now_playing_ids,omitempty"`
+	// EventIDs maps guild IDs to the scheduled event mirroring the session.
+	EventIDs map[string]string `json:"event_ids,omitempty"`
+	// Tokens maps Discord user IDs to 19box listener IDs.
+	Tokens map[string]string `json:"tokens,omitempty"`
+	// RequestCounts maps Discord user IDs to the number of their requests
+	// accepted in the session.
+	RequestCounts map[string]int `json:"request_counts,omitempty"`
+	// PostedTracks lists the track IDs already posted to the topic.
+	PostedTracks []string `json:"posted_tracks,omitempty"`
+	// PlayedTracks lists the tracks played in the session in the order they
+	// started.
+	PlayedTracks []PlayedTrack `json:"played_tracks,omitempty"`
+}
+
+// PlayedTrack is a track played in a session.
+type PlayedTrack struct {
+	TrackID         string    `json:"track_id"`
+	Name            string    `json:"name"`
+	Artists         []string  `json:"artists,omitempty"`
+	URL             string    `json:"url,omitempty"`
+	RequesterName   string    `json:"requester_name,omitempty"`
+	RequesterUserID string    `json:"requester_user_id,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+}
+
+// HistoryTrack is a track played in a guild, across sessions.
+type HistoryTrack struct {
+	TrackID string   `json:"track_id"`
+	Name    string   `json:"name"`
+	Artists []string `json:"artists,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	// AlbumArtURL is the album art of the track.
+	AlbumArtURL string `json:"album_art_url,omitempty"`
+	// Plays counts how many times the track has been played.
+	Plays        int       `json:"plays"`
+	LastPlayedAt time.Time `json:"last_played_at"`
+	// Requests counts how many requests of the track the server accepted.
+	Requests        int       `json:"requests,omitempty"`
+	LastRequestedAt time.Time `json:"last_requested_at,omitzero"`
+}
+
+// Store loads and saves SessionState keyed by SessionInfo.SessionId, and the
+// track history keyed by guild ID. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Load returns the state of sessionID, or nil if none has been saved.
+	Load(sessionID string) (*SessionState, error)
+	// Save replaces the stored state of state.SessionID.
+	Save(state *SessionState) error
+	// Delete removes the state of sessionID.
+	Delete(sessionID string) error
+
+	// LoadHistory returns the track history of guildID.
+	LoadHistory(guildID string) ([]HistoryTrack, error)
+	// SaveHistory replaces the track history of guildID.
+	SaveHistory(guildID string, tracks []HistoryTrack) error
+}
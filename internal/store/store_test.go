@@ -0,0 +1,148 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testState(sessionID string) *SessionState {
+	return &SessionState{
+		SessionID:     sessionID,
+		Started:       true,
+		TopicIDs:      map[string]string{"guild": "thread"},
+		NowPlayingIDs: map[string]string{"guild": "message"},
+		EventIDs:      map[string]string{"guild": "event"},
+		Tokens:        map[string]string{"u1": "listener-1"},
+		RequestCounts: map[string]int{"u1": 2},
+		PostedTracks:  []string{"t1", "t2"},
+		PlayedTracks: []PlayedTrack{
+			{TrackID: "t1", Name: "track t1", Artists: []string{"a"}, RequesterUserID: "u1", StartedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+	}
+}
+
+var testHistory = []HistoryTrack{
+	{TrackID: "t1", Name: "track t1", Plays: 3, LastPlayedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+}
+
+// testStore checks the behaviour every Store shares.
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	if state, err := s.Load("s1"); state != nil || err != nil {
+		t.Errorf("Load(unsaved) = %+v, %v, want nil", state, err)
+	}
+	if err := s.Save(testState("s1")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if state, err := s.Load("s1"); err != nil || !reflect.DeepEqual(state, testState("s1")) {
+		t.Errorf("Load = %+v, %v, want %+v", state, err, testState("s1"))
+	}
+	if err := s.SaveHistory("guild", testHistory); err != nil {
+		t.Fatalf("SaveHistory: %v", err)
+	}
+	if tracks, err := s.LoadHistory("guild"); err != nil || !reflect.DeepEqual(tracks, testHistory) {
+		t.Errorf("LoadHistory = %+v, %v", tracks, err)
+	}
+	if err := s.Delete("s1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if state, _ := s.Load("s1"); state != nil {
+		t.Errorf("Load(deleted) = %+v, want nil", state)
+	}
+	if err := s.Delete("s1"); err != nil {
+		t.Errorf("Delete(deleted) = %v", err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore(missing file): %v", err)
+	}
+	testStore(t, s)
+}
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"s1", "s2"} {
+		if err := s.Save(testState(id)); err != nil {
+			t.Fatalf("Save(%s): %v", id, err)
+		}
+	}
+	if err := s.SaveHistory("guild", testHistory); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("s2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted bot reads back what was saved
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if state, _ := reopened.Load("s1"); !reflect.DeepEqual(state, testState("s1")) {
+		t.Errorf("Load(s1) = %+v, want %+v", state, testState("s1"))
+	}
+	if state, _ := reopened.Load("s2"); state != nil {
+		t.Errorf("Load(s2) = %+v, want deleted", state)
+	}
+	if tracks, _ := reopened.LoadHistory("guild"); !reflect.DeepEqual(tracks, testHistory) {
+		t.Errorf("LoadHistory = %+v, want %+v", tracks, testHistory)
+	}
+
+	// saves go through a temporary file that does not outlive them
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Errorf("files = %v, want only the state file", entries)
+	}
+}
+
+func TestFileStoreFailedSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a directory in the way makes the final rename fail
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(testState("s1")); err == nil {
+		t.Error("Save = nil, want an error")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		t.Errorf("files = %v, want the temporary file removed", entries)
+	}
+}
+
+func TestFileStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"sessions":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Error("NewFileStore(corrupt file) = nil error, want an error")
+	}
+}